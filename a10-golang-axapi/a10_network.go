@@ -11,6 +11,7 @@
 package axapi
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"strings"
@@ -44,8 +45,13 @@ type DNS struct {
 // GetMgmtIntInfo -- Get info on the Management interface config
 //-----------------------------------------------------------------------------
 func (d Device) GetMgmtIntInfo() (NetInterface, error) {
+	return d.GetMgmtIntInfoCtx(context.Background())
+}
+
+// GetMgmtIntInfoCtx is GetMgmtIntInfo() with a Context, for a deadline or cancelling the call.
+func (d Device) GetMgmtIntInfoCtx(ctx context.Context) (NetInterface, error) {
 	ni := NetInterface{}
-	body, err := _restCall(d, "/interface/management", "GET", nil)
+	body, err := _restCallCtx(ctx, d, "/interface/management", "GET", nil)
 	if err != nil {
 		return ni, err
 	}
@@ -65,8 +71,13 @@ func (d Device) GetMgmtIntInfo() (NetInterface, error) {
 // GetIntInfo -- Get info on specified Network Interface
 //-----------------------------------------------------------------------------
 func (d Device) GetIntInfo(ni NetInterface) (NetInterface, error) {
+	return d.GetIntInfoCtx(context.Background(), ni)
+}
+
+// GetIntInfoCtx is GetIntInfo() with a Context, for a deadline or cancelling the call.
+func (d Device) GetIntInfoCtx(ctx context.Context, ni NetInterface) (NetInterface, error) {
 	url := "/interface/ethernet/" + strconv.Itoa(ni.IfNum)
-	body, err := _restCall(d, url, "GET", nil)
+	body, err := _restCallCtx(ctx, d, url, "GET", nil)
 	if err != nil {
 		return ni, err
 	}
@@ -88,9 +99,14 @@ func (d Device) GetIntInfo(ni NetInterface) (NetInterface, error) {
 // EnableInt -- Enable the specified Network Interface
 //-----------------------------------------------------------------------------
 func (d Device) EnableInt(ni NetInterface) (NetInterface, error) {
+	return d.EnableIntCtx(context.Background(), ni)
+}
+
+// EnableIntCtx is EnableInt() with a Context, for a deadline or cancelling the call.
+func (d Device) EnableIntCtx(ctx context.Context, ni NetInterface) (NetInterface, error) {
 	url := "/interface/ethernet/" + strconv.Itoa(ni.IfNum)
 	payload := strings.NewReader("{ \"ethernet\": { \"ifnum\": " + strconv.Itoa(ni.IfNum) + ", \"action\": \"enable\" } }")
-	body, err := _restCall(d, url, "POST", payload)
+	body, err := _restCallCtx(ctx, d, url, "POST", payload)
 	if err != nil {
 		return ni, err
 	}
@@ -106,9 +122,14 @@ func (d Device) EnableInt(ni NetInterface) (NetInterface, error) {
 // DisableInt -- Enable the specified Network Interface
 //-----------------------------------------------------------------------------
 func (d Device) DisableInt(ni NetInterface) (NetInterface, error) {
+	return d.DisableIntCtx(context.Background(), ni)
+}
+
+// DisableIntCtx is DisableInt() with a Context, for a deadline or cancelling the call.
+func (d Device) DisableIntCtx(ctx context.Context, ni NetInterface) (NetInterface, error) {
 	url := "/interface/ethernet/" + strconv.Itoa(ni.IfNum)
 	payload := strings.NewReader("{ \"ethernet\": { \"ifnum\": " + strconv.Itoa(ni.IfNum) + ", \"action\": \"disable\" } }")
-	body, err := _restCall(d, url, "POST", payload)
+	body, err := _restCallCtx(ctx, d, url, "POST", payload)
 	if err != nil {
 		return ni, err
 	}
@@ -124,6 +145,11 @@ func (d Device) DisableInt(ni NetInterface) (NetInterface, error) {
 // SetIntIPv4Address - Set an IPv4 Address on the specified Network Interface
 //-----------------------------------------------------------------------------
 func (d Device) SetIntIPv4Address(ni NetInterface) (NetInterface, error) {
+	return d.SetIntIPv4AddressCtx(context.Background(), ni)
+}
+
+// SetIntIPv4AddressCtx is SetIntIPv4Address() with a Context, for a deadline or cancelling the call.
+func (d Device) SetIntIPv4AddressCtx(ctx context.Context, ni NetInterface) (NetInterface, error) {
 	if ni.IPv4Address == "" {
 		return ni, errors.New("IPv4Address field not set")
 	}
@@ -143,7 +169,7 @@ func (d Device) SetIntIPv4Address(ni NetInterface) (NetInterface, error) {
 			ni.IPv4Netmask + "\" } } } }")
 	}
 
-	body, err := _restCall(d, url, "POST", payload)
+	body, err := _restCallCtx(ctx, d, url, "POST", payload)
 	if err != nil {
 		return ni, err
 	}
@@ -162,8 +188,13 @@ func (d Device) SetIntIPv4Address(ni NetInterface) (NetInterface, error) {
 // GetDNSinfo -- Gets all the DNS info from the Thunder device
 //-----------------------------------------------------------------------------
 func (d Device) GetDNSinfo() (DNS, error) {
+	return d.GetDNSinfoCtx(context.Background())
+}
+
+// GetDNSinfoCtx is GetDNSinfo() with a Context, for a deadline or cancelling the call.
+func (d Device) GetDNSinfoCtx(ctx context.Context) (DNS, error) {
 	dn := DNS{}
-	body, err := _restCall(d, "/ip/dns?detail=true", "GET", nil)
+	body, err := _restCallCtx(ctx, d, "/ip/dns?detail=true", "GET", nil)
 	if err != nil {
 		return dn, err
 	}
@@ -183,8 +214,13 @@ func (d Device) GetDNSinfo() (DNS, error) {
 // SetPrimaryIPv4DNSserver --  Sets the Primary DNS server
 //-----------------------------------------------------------------------------
 func (d Device) SetPrimaryIPv4DNSserver(dn DNS) (DNS, error) {
+	return d.SetPrimaryIPv4DNSserverCtx(context.Background(), dn)
+}
+
+// SetPrimaryIPv4DNSserverCtx is SetPrimaryIPv4DNSserver() with a Context, for a deadline or cancelling the call.
+func (d Device) SetPrimaryIPv4DNSserverCtx(ctx context.Context, dn DNS) (DNS, error) {
 	payload := strings.NewReader("{ \"primary\": { \"ip-v4-addr\": \"" + dn.PriIPv4 + "\" } }")
-	body, err := _restCall(d, "/ip/dns/primary", "POST", payload)
+	body, err := _restCallCtx(ctx, d, "/ip/dns/primary", "POST", payload)
 	if err != nil {
 		return dn, err
 	}
@@ -217,8 +253,13 @@ func (d Device) SetPrimaryIPv4DNSserver(dn DNS) (DNS, error) {
 // SetSecondaryIPv4DNSserver --  Sets the Primary DNS server
 //-----------------------------------------------------------------------------
 func (d Device) SetSecondaryIPv4DNSserver(dn DNS) (DNS, error) {
+	return d.SetSecondaryIPv4DNSserverCtx(context.Background(), dn)
+}
+
+// SetSecondaryIPv4DNSserverCtx is SetSecondaryIPv4DNSserver() with a Context, for a deadline or cancelling the call.
+func (d Device) SetSecondaryIPv4DNSserverCtx(ctx context.Context, dn DNS) (DNS, error) {
 	payload := strings.NewReader("{ \"secondary\": { \"ip-v4-addr\": \"" + dn.SecIPv4 + "\" } }")
-	body, err := _restCall(d, "/ip/dns/secondary", "POST", payload)
+	body, err := _restCallCtx(ctx, d, "/ip/dns/secondary", "POST", payload)
 	if err != nil {
 		return dn, err
 	}
@@ -234,8 +275,13 @@ func (d Device) SetSecondaryIPv4DNSserver(dn DNS) (DNS, error) {
 // SetDNSSuffix -- Sets the DNS Search suffix
 //-----------------------------------------------------------------------------
 func (d Device) SetDNSSuffix(dn DNS) (DNS, error) {
+	return d.SetDNSSuffixCtx(context.Background(), dn)
+}
+
+// SetDNSSuffixCtx is SetDNSSuffix() with a Context, for a deadline or cancelling the call.
+func (d Device) SetDNSSuffixCtx(ctx context.Context, dn DNS) (DNS, error) {
 	payload := strings.NewReader("{ \"suffix\": { \"domain-name\": \"" + dn.Suffix + "\" } }")
-	body, err := _restCall(d, "/ip/dns/suffix", "POST", payload)
+	body, err := _restCallCtx(ctx, d, "/ip/dns/suffix", "POST", payload)
 	if err != nil {
 		return dn, err
 	}
@@ -11,6 +11,9 @@
 package axapi
 
 import (
+	"context"
+	"encoding/json"
+	"strconv"
 	"strings"
 
 	"github.com/tidwall/gjson"
@@ -30,8 +33,13 @@ type Server struct {
 // GetSLBservers()
 //-----------------------------------------------------------------------------
 func (d Device) GetSLBservers() ([]Server, error) {
+	return d.GetSLBserversCtx(context.Background())
+}
+
+// GetSLBserversCtx is GetSLBservers() with a Context, for a deadline or cancelling the call.
+func (d Device) GetSLBserversCtx(ctx context.Context) ([]Server, error) {
 	var s []Server
-	body, err := _restCall(d, "/slb/server", "GET", nil)
+	body, err := _restCallCtx(ctx, d, "/slb/server", "GET", nil)
 	if err != nil {
 		return s, err
 	}
@@ -71,8 +79,13 @@ type SvcGrp struct {
 }
 
 func (d Device) GetServiceGroups() ([]SvcGrp, error) {
+	return d.GetServiceGroupsCtx(context.Background())
+}
+
+// GetServiceGroupsCtx is GetServiceGroups() with a Context, for a deadline or cancelling the call.
+func (d Device) GetServiceGroupsCtx(ctx context.Context) ([]SvcGrp, error) {
 	var sg []SvcGrp
-	body, err := _restCall(d, "/slb/service-group-list", "GET", nil)
+	body, err := _restCallCtx(ctx, d, "/slb/service-group-list", "GET", nil)
 	if err != nil {
 		return sg, err
 	}
@@ -100,6 +113,91 @@ func (d Device) GetServiceGroups() ([]SvcGrp, error) {
 	return sg, nil
 }
 
+// SetMemberState()
+//-----------------------------------------------------------------------------
+// state is "enable" or "disable". A disabled Member gets no new connections, but
+// connections already in flight are left alone.
+func (d Device) SetMemberState(sg string, m Member, state string) error {
+	return d.SetMemberStateCtx(context.Background(), sg, m, state)
+}
+
+// SetMemberStateCtx is SetMemberState() with a Context, for a deadline or cancelling the call.
+func (d Device) SetMemberStateCtx(ctx context.Context, sg string, m Member, state string) error {
+	url := "/slb/service-group/" + sg + "/member/" + m.Name + "+" + strconv.Itoa(m.Port)
+	pl := strings.NewReader("{\n\"member\": {\n\"name\": \"" + m.Name + "\",\n\"port\": " + strconv.Itoa(m.Port) + ",\n\"member-state\": \"" + state + "\"\n}\n}")
+	body, err := _restCallCtx(ctx, d, url, "POST", pl)
+	if err != nil {
+		return err
+	}
+	if e, msg := d.chkResp(body); e {
+		return msg
+	}
+	return nil
+}
+
+// DisableMember()
+//-----------------------------------------------------------------------------
+func (d Device) DisableMember(sg string, m Member) error {
+	return d.DisableMemberCtx(context.Background(), sg, m)
+}
+
+// DisableMemberCtx is DisableMember() with a Context, for a deadline or cancelling the call.
+func (d Device) DisableMemberCtx(ctx context.Context, sg string, m Member) error {
+	return d.SetMemberStateCtx(ctx, sg, m, "disable")
+}
+
+// EnableMember()
+//-----------------------------------------------------------------------------
+func (d Device) EnableMember(sg string, m Member) error {
+	return d.EnableMemberCtx(context.Background(), sg, m)
+}
+
+// EnableMemberCtx is EnableMember() with a Context, for a deadline or cancelling the call.
+func (d Device) EnableMemberCtx(ctx context.Context, sg string, m Member) error {
+	return d.SetMemberStateCtx(ctx, sg, m, "enable")
+}
+
+// GetMemberStats()
+//-----------------------------------------------------------------------------
+type MemberStats struct {
+	CurrConn       uint64 `json:"curr_conn"`
+	TotalConn      uint64 `json:"total_conn"`
+	TotalFwdBytes  uint64 `json:"total_fwd_bytes"`
+	TotalFwdPkts   uint64 `json:"total_fwd_pkts"`
+	TotalRevBytes  uint64 `json:"total_rev_bytes"`
+	TotalRevPkts   uint64 `json:"total_rev_pkts"`
+	CurrReq        uint64 `json:"curr_req"`
+	TotalReq       uint64 `json:"total_req"`
+	TotalReqSucc   uint64 `json:"total_req_succ"`
+	PeakConn       uint64 `json:"peak_conn"`
+	ResponseTime   uint64 `json:"response_time"`
+	FastestRspTime uint64 `json:"fastest_rsp_time"`
+	SlowestRspTime uint64 `json:"slowest_rsp_time"`
+	CurrSSLConn    uint64 `json:"curr_ssl_conn"`
+	TotalSSLConn   uint64 `json:"total_ssl_conn"`
+	StateFlaps     uint64 `json:"state_flaps"`
+}
+
+func (d Device) GetMemberStats(sg string, m Member) (MemberStats, error) {
+	return d.GetMemberStatsCtx(context.Background(), sg, m)
+}
+
+// GetMemberStatsCtx is GetMemberStats() with a Context, for a deadline or cancelling the call.
+func (d Device) GetMemberStatsCtx(ctx context.Context, sg string, m Member) (MemberStats, error) {
+	var ms MemberStats
+	url := "/slb/service-group/" + sg + "/member/" + m.Name + "+" + strconv.Itoa(m.Port) + "/stats"
+	body, err := _restCallCtx(ctx, d, url, "GET", nil)
+	if err != nil {
+		return ms, err
+	}
+	if e, msg := d.chkResp(body); e {
+		return ms, msg
+	}
+
+	err = json.Unmarshal([]byte(gjson.GetBytes(body, "member.stats").Raw), &ms)
+	return ms, err
+}
+
 // GetVSlist()
 //-----------------------------------------------------------------------------
 type Port struct {
@@ -120,8 +218,13 @@ type VS struct {
 }
 
 func (d Device) GetVSlist() ([]VS, error) {
+	return d.GetVSlistCtx(context.Background())
+}
+
+// GetVSlistCtx is GetVSlist() with a Context, for a deadline or cancelling the call.
+func (d Device) GetVSlistCtx(ctx context.Context) ([]VS, error) {
 	var vsl []VS
-	body, err := _restCall(d, "/slb/virtual-server-list", "GET", nil)
+	body, err := _restCallCtx(ctx, d, "/slb/virtual-server-list", "GET", nil)
 	if err != nil {
 		return vsl, err
 	}
@@ -247,11 +350,16 @@ func (d Device) GetVSlist() ([]VS, error) {
 // }
 
 func (d Device) GetVSThroughput(vs string, p string) (Port, error) {
+	return d.GetVSThroughputCtx(context.Background(), vs, p)
+}
+
+// GetVSThroughputCtx is GetVSThroughput() with a Context, for a deadline or cancelling the call.
+func (d Device) GetVSThroughputCtx(ctx context.Context, vs string, p string) (Port, error) {
 	// p is in the format "80+http" to match the API call URL requirement.
 	// Throughput returned is in bps
 	var port Port
 	url := "/slb/virtual-server/" + vs + "/port/" + p + "/stats"
-	body, err := _restCall(d, url, "GET", nil)
+	body, err := _restCallCtx(ctx, d, url, "GET", nil)
 	if err != nil {
 		return port, err
 	}
@@ -266,11 +374,109 @@ func (d Device) GetVSThroughput(vs string, p string) (Port, error) {
 	return port, nil
 }
 
+// GetVSPortStats()
+//-----------------------------------------------------------------------------
+// PortStats holds the counters returned by the Virtual Server Port stats call shown above.
+// The per-type DNS filter & RPZ counters are not included.
+type PortStats struct {
+	PortNumber              int    `json:"-"`
+	Protocol                string `json:"-"`
+	CurrConn                uint64 `json:"curr_conn"`
+	TotalL4Conn             uint64 `json:"total_l4_conn"`
+	TotalL7Conn             uint64 `json:"total_l7_conn"`
+	TotalTCPConn            uint64 `json:"total_tcp_conn"`
+	TotalConn               uint64 `json:"total_conn"`
+	TotalFwdBytes           uint64 `json:"total_fwd_bytes"`
+	TotalFwdPkts            uint64 `json:"total_fwd_pkts"`
+	TotalRevBytes           uint64 `json:"total_rev_bytes"`
+	TotalRevPkts            uint64 `json:"total_rev_pkts"`
+	TotalDNSPkts            uint64 `json:"total_dns_pkts"`
+	TotalMfDNSPkts          uint64 `json:"total_mf_dns_pkts"`
+	ESTotalFailureActions   uint64 `json:"es_total_failure_actions"`
+	CompressionBytesBefore  uint64 `json:"compression_bytes_before"`
+	CompressionBytesAfter   uint64 `json:"compression_bytes_after"`
+	CompressionHit          uint64 `json:"compression_hit"`
+	CompressionMiss         uint64 `json:"compression_miss"`
+	CompressionMissNoClient uint64 `json:"compression_miss_no_client"`
+	CompressionMissTplExcl  uint64 `json:"compression_miss_template_exclusion"`
+	CurrReq                 uint64 `json:"curr_req"`
+	TotalReq                uint64 `json:"total_req"`
+	TotalReqSucc            uint64 `json:"total_req_succ"`
+	PeakConn                uint64 `json:"peak_conn"`
+	CurrConnRate            uint64 `json:"curr_conn_rate"`
+	LastRspTime             uint64 `json:"last_rsp_time"`
+	FastestRspTime          uint64 `json:"fastest_rsp_time"`
+	SlowestRspTime          uint64 `json:"slowest_rsp_time"`
+	LocPermit               uint64 `json:"loc_permit"`
+	LocDeny                 uint64 `json:"loc_deny"`
+	LocConn                 uint64 `json:"loc_conn"`
+	CurrSSLConn             uint64 `json:"curr_ssl_conn"`
+	TotalSSLConn            uint64 `json:"total_ssl_conn"`
+	BackendTimeToFirstByte  uint64 `json:"backend-time-to-first-byte"`
+	BackendTimeToLastByte   uint64 `json:"backend-time-to-last-byte"`
+	InLatency               uint64 `json:"in-latency"`
+	OutLatency              uint64 `json:"out-latency"`
+	TotalFwdBytesOut        uint64 `json:"total_fwd_bytes_out"`
+	TotalFwdPktsOut         uint64 `json:"total_fwd_pkts_out"`
+	TotalRevBytesOut        uint64 `json:"total_rev_bytes_out"`
+	TotalRevPktsOut         uint64 `json:"total_rev_pkts_out"`
+	CurrReqRate             uint64 `json:"curr_req_rate"`
+	CurrResp                uint64 `json:"curr_resp"`
+	TotalResp               uint64 `json:"total_resp"`
+	TotalRespSucc           uint64 `json:"total_resp_succ"`
+	CurrRespRate            uint64 `json:"curr_resp_rate"`
+	CurrConnOverflow        uint64 `json:"curr_conn_overflow"`
+	DNSRRLTotalAllowed      uint64 `json:"dnsrrl_total_allowed"`
+	DNSRRLTotalDropped      uint64 `json:"dnsrrl_total_dropped"`
+	DNSRRLTotalSlipped      uint64 `json:"dnsrrl_total_slipped"`
+	DNSRRLBadFQDN           uint64 `json:"dnsrrl_bad_fqdn"`
+	Throughput              uint64 `json:"throughput-bits-per-sec"`
+	DynamicMemory           uint64 `json:"dynamic-memory"`
+	IPOnlyLBFwdBytes        uint64 `json:"ip_only_lb_fwd_bytes"`
+	IPOnlyLBRevBytes        uint64 `json:"ip_only_lb_rev_bytes"`
+	IPOnlyLBFwdPkts         uint64 `json:"ip_only_lb_fwd_pkts"`
+	IPOnlyLBRevPkts         uint64 `json:"ip_only_lb_rev_pkts"`
+	TotalDNSFilterTypeDrop  uint64 `json:"total_dns_filter_type_drop"`
+	TotalDNSFilterClassDrop uint64 `json:"total_dns_filter_class_drop"`
+}
+
+func (d Device) GetVSPortStats(vs string, p string) (PortStats, error) {
+	return d.GetVSPortStatsCtx(context.Background(), vs, p)
+}
+
+// GetVSPortStatsCtx is GetVSPortStats() with a Context, for a deadline or cancelling the call.
+func (d Device) GetVSPortStatsCtx(ctx context.Context, vs string, p string) (PortStats, error) {
+	// p is in the format "80+http" to match the API call URL requirement.
+	var ps PortStats
+	url := "/slb/virtual-server/" + vs + "/port/" + p + "/stats"
+	body, err := _restCallCtx(ctx, d, url, "GET", nil)
+	if err != nil {
+		return ps, err
+	}
+	if e, msg := d.chkResp(body); e {
+		return ps, msg
+	}
+
+	err = json.Unmarshal([]byte(gjson.GetBytes(body, "port.stats").Raw), &ps)
+	if err != nil {
+		return ps, err
+	}
+	ps.PortNumber = int(gjson.GetBytes(body, "port.port-number").Int())
+	ps.Protocol = gjson.GetBytes(body, "port.protocol").Str
+
+	return ps, nil
+}
+
 // GetServerTemplate()
 //-----------------------------------------------------------------------------
 func (d Device) GetServerTemplate(tpl string) (string, error) {
+	return d.GetServerTemplateCtx(context.Background(), tpl)
+}
+
+// GetServerTemplateCtx is GetServerTemplate() with a Context, for a deadline or cancelling the call.
+func (d Device) GetServerTemplateCtx(ctx context.Context, tpl string) (string, error) {
 	url := "/slb/template/server/" + tpl
-	body, err := _restCall(d, url, "GET", nil)
+	body, err := _restCallCtx(ctx, d, url, "GET", nil)
 	if err != nil {
 		return "", err
 	}
@@ -283,8 +489,13 @@ func (d Device) GetServerTemplate(tpl string) (string, error) {
 // GetVirtualServerTemplate()
 //-----------------------------------------------------------------------------
 func (d Device) GetVirtualServerTemplate(tpl string) (string, error) {
+	return d.GetVirtualServerTemplateCtx(context.Background(), tpl)
+}
+
+// GetVirtualServerTemplateCtx is GetVirtualServerTemplate() with a Context, for a deadline or cancelling the call.
+func (d Device) GetVirtualServerTemplateCtx(ctx context.Context, tpl string) (string, error) {
 	url := "/slb/template/virtual-server/" + tpl
-	body, err := _restCall(d, url, "GET", nil)
+	body, err := _restCallCtx(ctx, d, url, "GET", nil)
 	if err != nil {
 		return "", err
 	}
@@ -297,6 +508,11 @@ func (d Device) GetVirtualServerTemplate(tpl string) (string, error) {
 // CreateServerTemplate()
 //-----------------------------------------------------------------------------
 func (d Device) CreateServerTemplate(payload string) error {
+	return d.CreateServerTemplateCtx(context.Background(), payload)
+}
+
+// CreateServerTemplateCtx is CreateServerTemplate() with a Context, for a deadline or cancelling the call.
+func (d Device) CreateServerTemplateCtx(ctx context.Context, payload string) error {
 	// Payload should have at least the 'name' field, and any attributes you want to set.
 	// Example:
 	// "server": {
@@ -323,7 +539,7 @@ func (d Device) CreateServerTemplate(payload string) error {
 	// }
 	url := "/slb/template/server"
 	pl := strings.NewReader(payload)
-	body, err := _restCall(d, url, "POST", pl)
+	body, err := _restCallCtx(ctx, d, url, "POST", pl)
 	if err != nil {
 		return err
 	}
@@ -336,10 +552,15 @@ func (d Device) CreateServerTemplate(payload string) error {
 // UpdateServerTemplate()
 //-----------------------------------------------------------------------------
 func (d Device) UpdateServerTemplate(payload string) error {
+	return d.UpdateServerTemplateCtx(context.Background(), payload)
+}
+
+// UpdateServerTemplateCtx is UpdateServerTemplate() with a Context, for a deadline or cancelling the call.
+func (d Device) UpdateServerTemplateCtx(ctx context.Context, payload string) error {
 	// NOTE: The 'name' field MUST be a part of the payload!
 	url := "/slb/template/server"
 	pl := strings.NewReader(payload)
-	body, err := _restCall(d, url, "PUT", pl)
+	body, err := _restCallCtx(ctx, d, url, "PUT", pl)
 	if err != nil {
 		return err
 	}
@@ -359,9 +580,14 @@ func (d Device) UpdateServerTemplate(payload string) error {
 // 	  "conn-rate-limit": 200
 // }
 func (d Device) CreateVirtualServerTemplate(payload string) error {
+	return d.CreateVirtualServerTemplateCtx(context.Background(), payload)
+}
+
+// CreateVirtualServerTemplateCtx is CreateVirtualServerTemplate() with a Context, for a deadline or cancelling the call.
+func (d Device) CreateVirtualServerTemplateCtx(ctx context.Context, payload string) error {
 	url := "/slb/template/virtual-server"
 	pl := strings.NewReader(payload)
-	body, err := _restCall(d, url, "POST", pl)
+	body, err := _restCallCtx(ctx, d, url, "POST", pl)
 	if err != nil {
 		return err
 	}
@@ -374,10 +600,15 @@ func (d Device) CreateVirtualServerTemplate(payload string) error {
 // UpdateVirtualServerTemplate()
 //-----------------------------------------------------------------------------
 func (d Device) UpdateVirtualServerTemplate(payload string) error {
+	return d.UpdateVirtualServerTemplateCtx(context.Background(), payload)
+}
+
+// UpdateVirtualServerTemplateCtx is UpdateVirtualServerTemplate() with a Context, for a deadline or cancelling the call.
+func (d Device) UpdateVirtualServerTemplateCtx(ctx context.Context, payload string) error {
 	// NOTE: The 'name' field MUST be a part of the payload!
 	url := "/slb/template/virtual-server"
 	pl := strings.NewReader(payload)
-	body, err := _restCall(d, url, "PUT", pl)
+	body, err := _restCallCtx(ctx, d, url, "PUT", pl)
 	if err != nil {
 		return err
 	}
@@ -393,9 +624,14 @@ func (d Device) UpdateVirtualServerTemplate(payload string) error {
 // if they already exist, or add KV lines to the virtual-server config. It retains
 // all other vaules (unlike a PUT would.)
 func (d Device) UpdateVirtualServer(vs string, payload string) error {
+	return d.UpdateVirtualServerCtx(context.Background(), vs, payload)
+}
+
+// UpdateVirtualServerCtx is UpdateVirtualServer() with a Context, for a deadline or cancelling the call.
+func (d Device) UpdateVirtualServerCtx(ctx context.Context, vs string, payload string) error {
 	url := "/slb/virtual-server/" + vs
 	pl := strings.NewReader(payload)
-	body, err := _restCall(d, url, "POST", pl)
+	body, err := _restCallCtx(ctx, d, url, "POST", pl)
 	if err != nil {
 		return err
 	}
@@ -11,6 +11,7 @@
 package axapi
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -21,7 +22,12 @@ import (
 // GetUptime returns the Thunder's uptime as a string
 //-----------------------------------------------------------------------------
 func (d Device) GetUptime() (string, error) {
-	body, err := _restCall(d, "/version/oper", "GET", nil)
+	return d.GetUptimeCtx(context.Background())
+}
+
+// GetUptimeCtx is GetUptime() with a Context, for a deadline or cancelling the call.
+func (d Device) GetUptimeCtx(ctx context.Context) (string, error) {
+	body, err := _restCallCtx(ctx, d, "/version/oper", "GET", nil)
 	if err != nil {
 		return "", err
 	}
@@ -36,7 +42,12 @@ func (d Device) GetUptime() (string, error) {
 // GetPlatform -- What hardware/software is Thunder running on?
 //-----------------------------------------------------------------------------
 func (d Device) GetPlatform() (string, error) {
-	body, err := _restCall(d, "/version/oper", "GET", nil)
+	return d.GetPlatformCtx(context.Background())
+}
+
+// GetPlatformCtx is GetPlatform() with a Context, for a deadline or cancelling the call.
+func (d Device) GetPlatformCtx(ctx context.Context) (string, error) {
+	body, err := _restCallCtx(ctx, d, "/version/oper", "GET", nil)
 	if err != nil {
 		return "", err
 	}
@@ -58,8 +69,13 @@ type BootInfo struct {
 // GetBootInfo - Return struct with info about the two partitions, and which one is booting from.
 //-----------------------------------------------------------------------------
 func (d Device) GetBootInfo() (BootInfo, error) {
+	return d.GetBootInfoCtx(context.Background())
+}
+
+// GetBootInfoCtx is GetBootInfo() with a Context, for a deadline or cancelling the call.
+func (d Device) GetBootInfoCtx(ctx context.Context) (BootInfo, error) {
 	var b BootInfo
-	body, err := _restCall(d, "/bootimage/oper", "GET", nil)
+	body, err := _restCallCtx(ctx, d, "/bootimage/oper", "GET", nil)
 	if err != nil {
 		return BootInfo{}, nil
 	}
@@ -77,7 +93,12 @@ func (d Device) GetBootInfo() (BootInfo, error) {
 // GetLastConfigSave - Returns string with time/date of last config save (IE> mem wr)
 //-----------------------------------------------------------------------------
 func (d Device) GetLastConfigSave() (string, error) {
-	body, err := _restCall(d, "/version/oper", "GET", nil)
+	return d.GetLastConfigSaveCtx(context.Background())
+}
+
+// GetLastConfigSaveCtx is GetLastConfigSave() with a Context, for a deadline or cancelling the call.
+func (d Device) GetLastConfigSaveCtx(ctx context.Context) (string, error) {
+	body, err := _restCallCtx(ctx, d, "/version/oper", "GET", nil)
 	if err != nil {
 		return "", err
 	}
@@ -92,7 +113,12 @@ func (d Device) GetLastConfigSave() (string, error) {
 // GetControlCPUs - Returns number of control CPUs
 //-----------------------------------------------------------------------------
 func (d Device) GetControlCPUs() (int, error) {
-	body, err := _restCall(d, "/version/oper", "GET", nil)
+	return d.GetControlCPUsCtx(context.Background())
+}
+
+// GetControlCPUsCtx is GetControlCPUs() with a Context, for a deadline or cancelling the call.
+func (d Device) GetControlCPUsCtx(ctx context.Context) (int, error) {
+	body, err := _restCallCtx(ctx, d, "/version/oper", "GET", nil)
 	if err != nil {
 		return 0, err
 	}
@@ -107,7 +133,12 @@ func (d Device) GetControlCPUs() (int, error) {
 // GetTimezone - What is the Timezone setting on the Thunder device.
 //-----------------------------------------------------------------------------
 func (d Device) GetTimezone() (string, error) {
-	body, err := _restCall(d, "/timezone/oper", "GET", nil)
+	return d.GetTimezoneCtx(context.Background())
+}
+
+// GetTimezoneCtx is GetTimezone() with a Context, for a deadline or cancelling the call.
+func (d Device) GetTimezoneCtx(ctx context.Context) (string, error) {
+	body, err := _restCallCtx(ctx, d, "/timezone/oper", "GET", nil)
 	if err != nil {
 		return "", err
 	}
@@ -122,9 +153,14 @@ func (d Device) GetTimezone() (string, error) {
 // SetTimezone - Set the TZ string
 //-----------------------------------------------------------------------------
 func (d Device) SetTimezone(tz string) error {
+	return d.SetTimezoneCtx(context.Background(), tz)
+}
+
+// SetTimezoneCtx is SetTimezone() with a Context, for a deadline or cancelling the call.
+func (d Device) SetTimezoneCtx(ctx context.Context, tz string) error {
 	payload := strings.NewReader("{ \"timezone\": {\"timezone-index-cfg\": {\"timezone-index\": \"" + tz + "\" } } }")
 
-	body, err := _restCall(d, "/timezone", "POST", payload)
+	body, err := _restCallCtx(ctx, d, "/timezone", "POST", payload)
 	if err != nil {
 		return err
 	}
@@ -139,9 +175,14 @@ func (d Device) SetTimezone(tz string) error {
 // SetHostname - Set the Hostname for the Thunder device
 //-----------------------------------------------------------------------------
 func (d Device) SetHostname(hn string) error {
+	return d.SetHostnameCtx(context.Background(), hn)
+}
+
+// SetHostnameCtx is SetHostname() with a Context, for a deadline or cancelling the call.
+func (d Device) SetHostnameCtx(ctx context.Context, hn string) error {
 	payload := strings.NewReader("{ \"hostname\": {\"value\": \"" + hn + "\" } }")
 
-	body, err := _restCall(d, "/hostname", "PUT", payload)
+	body, err := _restCallCtx(ctx, d, "/hostname", "PUT", payload)
 	if err != nil {
 		return err
 	}
@@ -156,8 +197,13 @@ func (d Device) SetHostname(hn string) error {
 // GetProcessInfo - Get the list of running processes
 //-----------------------------------------------------------------------------
 func (d Device) GetProcessInfo() ([]string, error) {
+	return d.GetProcessInfoCtx(context.Background())
+}
+
+// GetProcessInfoCtx is GetProcessInfo() with a Context, for a deadline or cancelling the call.
+func (d Device) GetProcessInfoCtx(ctx context.Context) ([]string, error) {
 	var rr []string
-	body, err := _restCall(d, "/system-view/show-process/oper", "GET", nil)
+	body, err := _restCallCtx(ctx, d, "/system-view/show-process/oper", "GET", nil)
 	if err != nil {
 		return []string{}, err
 	}
@@ -181,8 +227,13 @@ func (d Device) GetProcessInfo() ([]string, error) {
 // CliDeploy - Run a CLI command via the API call
 //-----------------------------------------------------------------------------
 func (d Device) CliDeploy(cmd string) (string, error) {
+	return d.CliDeployCtx(context.Background(), cmd)
+}
+
+// CliDeployCtx is CliDeploy() with a Context, for a deadline or cancelling the call.
+func (d Device) CliDeployCtx(ctx context.Context, cmd string) (string, error) {
 	c := strings.NewReader(cmd)
-	body, err := _restCall(d, "/clideploy", "POST", c)
+	body, err := _restCallCtx(ctx, d, "/clideploy", "POST", c)
 	if err != nil {
 		return "", err
 	}
@@ -12,12 +12,17 @@
 package axapi
 
 import (
+	"context"
 	"crypto/tls"
 	//"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	neturl "net/url"
 	"strings"
+	"time"
 
 	"github.com/tidwall/gjson"
 )
@@ -34,11 +39,91 @@ type Device struct {
 	Hardware     string
 	BootFrom     string
 	SerialNumber string
+	Retry        Retry
 }
 
+// Retry says how to retry calls that fail in a way that may clear up by itself: network
+// errors, and 429, 502, 503 & 504 responses. Only GETs are retried after a network error,
+// as we cannot tell whether the Thunder acted on anything else. The zero value tries each
+// call just once.
+//-----------------------------------------------------------------------------
+type Retry struct {
+	Attempts int           // Tries per call, including the first
+	Backoff  time.Duration // Wait before the first retry; doubled for each retry after that
+	Max      time.Duration // Longest wait between tries
+}
+
+// Skip insecure SSL verify returns -- lots of Thunders don't have this set.
+// One client for all calls, so connections to the Thunder get reused.
+var client = &http.Client{Transport: &http.Transport{
+	TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+}}
+
 // _restCall is the basic API callout function
 //-----------------------------------------------------------------------------
 func _restCall(d Device, url string, method string, payload *strings.Reader) ([]byte, error) {
+	return _restCallCtx(context.Background(), d, url, method, payload)
+}
+
+// _restCallCtx is _restCall with a Context; the call gives up when the Context is done,
+// including while waiting to retry.
+//-----------------------------------------------------------------------------
+func _restCallCtx(ctx context.Context, d Device, url string, method string, payload *strings.Reader) ([]byte, error) {
+	if payload == nil {
+		payload = strings.NewReader("")
+	}
+	for try := 1; ; try++ {
+		payload.Seek(0, io.SeekStart)
+		body, err := _restCallOnce(ctx, d, url, method, payload)
+		if err == nil || try >= d.Retry.Attempts || !retryable(ctx, method, err) {
+			return body, err
+		}
+		if d.Retry.wait(ctx, try) != nil {
+			return body, err
+		}
+	}
+}
+
+// retryable -- True if a failed call is worth trying again.
+//-----------------------------------------------------------------------------
+func retryable(ctx context.Context, method string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	for _, s := range []string{"429", "502", "503", "504"} {
+		if strings.HasPrefix(err.Error(), s) {
+			return true
+		}
+	}
+	var ue *neturl.Error
+	return (method == "" || method == "GET") && errors.As(err, &ue)
+}
+
+// wait -- Sleep before retry number 'try', with jitter so callers do not retry in step.
+// Returns the Context's error if it is done first.
+//-----------------------------------------------------------------------------
+func (r Retry) wait(ctx context.Context, try int) error {
+	w := r.Backoff
+	for i := 1; i < try && (r.Max == 0 || w < r.Max); i++ {
+		w *= 2
+	}
+	if r.Max > 0 && w > r.Max {
+		w = r.Max
+	}
+	w = w/2 + time.Duration(rand.Int63n(int64(w/2)+1))
+	t := time.NewTimer(w)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// _restCallOnce makes a single try of the call.
+//-----------------------------------------------------------------------------
+func _restCallOnce(ctx context.Context, d Device, url string, method string, payload *strings.Reader) ([]byte, error) {
 	var body []byte
 	if d.Token == "" && url != "/auth" {
 		return []byte{}, errors.New("No A10 Auth Token! You must Login() before calling other API calls")
@@ -48,17 +133,9 @@ func _restCall(d Device, url string, method string, payload *strings.Reader) ([]
 	if method == "" {
 		method = "GET"
 	}
-	if payload == nil {
-		payload = strings.NewReader("")
-	}
 
-	// Skip insecure SSL verify returns -- lots of Thunders don't have this set.
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
 	// set the HTTPS request
-	req, err := http.NewRequest(method, u, payload)
+	req, err := http.NewRequestWithContext(ctx, method, u, payload)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -108,6 +185,11 @@ func (d Device) chkResp(b []byte) (bool, error) {
 // Login to the A10 Thunder device
 //-----------------------------------------------------------------------------
 func (d Device) Login() (Device, error) {
+	return d.LoginCtx(context.Background())
+}
+
+// LoginCtx is Login() with a Context, for a deadline or cancelling the call.
+func (d Device) LoginCtx(ctx context.Context) (Device, error) {
 	if d.Username == "" {
 		d.Username = "admin"
 	}
@@ -117,7 +199,7 @@ func (d Device) Login() (Device, error) {
 
 	payload := strings.NewReader("{\n\"credentials\": {\n\"username\": \"" + d.Username + "\",\n\"password\": \"" + d.Password + "\"\n}\n}")
 
-	body, err := _restCall(d, "/auth", "POST", payload)
+	body, err := _restCallCtx(ctx, d, "/auth", "POST", payload)
 	if err != nil {
 		return d, err
 	}
@@ -129,7 +211,12 @@ func (d Device) Login() (Device, error) {
 // GetHostname gets the hostname that the Thunder Device has currently assigned.
 //-----------------------------------------------------------------------------
 func (d Device) GetHostname() (Device, error) {
-	body, err := _restCall(d, "/hostname", "GET", nil)
+	return d.GetHostnameCtx(context.Background())
+}
+
+// GetHostnameCtx is GetHostname() with a Context, for a deadline or cancelling the call.
+func (d Device) GetHostnameCtx(ctx context.Context) (Device, error) {
+	body, err := _restCallCtx(ctx, d, "/hostname", "GET", nil)
 	if err != nil {
 		return d, err
 	}
@@ -141,7 +228,12 @@ func (d Device) GetHostname() (Device, error) {
 // GetVersion retrieves ACOS version info
 //-----------------------------------------------------------------------------
 func (d Device) GetVersion() (Device, error) {
-	body, err := _restCall(d, "/version/oper", "GET", nil)
+	return d.GetVersionCtx(context.Background())
+}
+
+// GetVersionCtx is GetVersion() with a Context, for a deadline or cancelling the call.
+func (d Device) GetVersionCtx(ctx context.Context) (Device, error) {
+	body, err := _restCallCtx(ctx, d, "/version/oper", "GET", nil)
 	if err != nil {
 		return d, err
 	}
@@ -156,7 +248,12 @@ func (d Device) GetVersion() (Device, error) {
 // GetVirtType will return a string of the virtualization type, if available
 //-----------------------------------------------------------------------------
 func (d Device) GetVirtType() (string, error) {
-	body, err := _restCall(d, "/version/oper", "GET", nil)
+	return d.GetVirtTypeCtx(context.Background())
+}
+
+// GetVirtTypeCtx is GetVirtType() with a Context, for a deadline or cancelling the call.
+func (d Device) GetVirtTypeCtx(ctx context.Context) (string, error) {
+	body, err := _restCallCtx(ctx, d, "/version/oper", "GET", nil)
 	if err != nil {
 		return "", err
 	}
@@ -167,7 +264,12 @@ func (d Device) GetVirtType() (string, error) {
 // Logoff - terminates the current API session
 //-----------------------------------------------------------------------------
 func (d Device) Logoff() (Device, error) {
-	body, err := _restCall(d, "/logoff", "GET", nil)
+	return d.LogoffCtx(context.Background())
+}
+
+// LogoffCtx is Logoff() with a Context, for a deadline or cancelling the call.
+func (d Device) LogoffCtx(ctx context.Context) (Device, error) {
+	body, err := _restCallCtx(ctx, d, "/logoff", "GET", nil)
 	if err != nil {
 		return d, err
 	}
@@ -0,0 +1,158 @@
+package main
+
+//
+//  audit.go
+//   Audit trail of every scaling evaluation, written as one JSON object per line to a file (rotated by
+//   size) or to stdout. This is kept apart from the human readable log on stderr, so a post-incident
+//   review can see exactly what the agent saw and did for each Target, every check interval.
+//
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"a10/axapi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AuditConfig is the 'audit' section of the config file.
+type AuditConfig struct {
+	Output    string `yaml:"output"`    // File path, or "stdout"; blank to turn off
+	Max_Size  int    `yaml:"max_size"`  // Rotate the file when it gets this big, in MB
+	Max_Files int    `yaml:"max_files"` // Rotated files to keep
+}
+
+const (
+	defaultAuditMaxSize  = 100
+	defaultAuditMaxFiles = 5
+)
+
+// auditRecord is one line of the audit log.
+type auditRecord struct {
+	Time            string             `json:"time"`
+	Kind            string             `json:"kind"` // "evaluation", or "drain" when a drained scale down finishes
+	Target          string             `json:"target"`
+	Deployment      string             `json:"deployment"` // namespace/name
+	DryRun          bool               `json:"dry_run"`
+	Stats           *axapi.PortStats   `json:"stats,omitempty"` // Raw Thunder Port stats
+	StatsError      string             `json:"stats_error,omitempty"`
+	StatsAge        float64            `json:"stats_age_s"`           // Seconds since the last good stats
+	Metrics         map[string]float64 `json:"metrics,omitempty"`     // As used by the policy, after any smoothing
+	RawMetrics      map[string]float64 `json:"raw_metrics,omitempty"` // Before smoothing, when a metric is smoothed
+	CurrentReplicas int                `json:"current_replicas"`
+	Simulated       int                `json:"simulated_replicas,omitempty"` // Dry Run: the Replicas the policy worked from
+	PolicyReplicas  int                `json:"policy_replicas"`
+	Reason          string             `json:"reason,omitempty"`
+	Predicted       int                `json:"predicted_replicas,omitempty"`
+	Stabilized      int                `json:"stabilized_replicas"`
+	MinReplicas     int                `json:"min_replicas"`
+	MaxReplicas     int                `json:"max_replicas"`
+	Schedules       []string           `json:"schedules,omitempty"`
+	Degraded        string             `json:"degraded,omitempty"` // Degraded mode action taken without stats
+	Clamped         string             `json:"clamped,omitempty"`  // "min" or "max"
+	DesiredReplicas int                `json:"desired_replicas"`
+	Action          string             `json:"action"` // none, scale_up, scale_down, cooldown, skipped, hold, error
+	Result          string             `json:"result,omitempty"`
+}
+
+// auditLog is where audit records go. A zero auditLog throws them away.
+type auditLog struct {
+	mu       sync.Mutex
+	cfg      AuditConfig
+	w        io.Writer
+	f        *os.File // nil when writing to stdout
+	size     int64
+	maxSize  int64
+	maxFiles int
+}
+
+var audit = &auditLog{}
+
+//---------------------------------------------------------------------------------
+// open()  --  Start writing audit records as set in the config, closing any file already open.
+func (a *auditLog) open(ac AuditConfig) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f != nil {
+		a.f.Close()
+	}
+	a.cfg, a.w, a.f, a.size = ac, nil, nil, 0
+	a.maxSize = int64(ac.Max_Size) * 1024 * 1024
+	if a.maxSize == 0 {
+		a.maxSize = defaultAuditMaxSize * 1024 * 1024
+	}
+	a.maxFiles = ac.Max_Files
+	if a.maxFiles == 0 {
+		a.maxFiles = defaultAuditMaxFiles
+	}
+	switch ac.Output {
+	case "":
+		return nil
+	case "stdout":
+		a.w = os.Stdout
+		return nil
+	}
+	return a.openFile()
+}
+
+func (a *auditLog) openFile() error {
+	f, err := os.OpenFile(a.cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.w, a.f, a.size = f, f, st.Size()
+	return nil
+}
+
+// rotate()  --  file -> file.1 -> file.2 ..., dropping the oldest.
+func (a *auditLog) rotate() error {
+	a.f.Close()
+	a.w, a.f = nil, nil
+	fn := a.cfg.Output
+	os.Remove(fn + "." + strconv.Itoa(a.maxFiles))
+	for i := a.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fn+"."+strconv.Itoa(i), fn+"."+strconv.Itoa(i+1))
+	}
+	if err := os.Rename(fn, fn+".1"); err != nil {
+		a.openFile() // Keep adding to the one we have
+		return err
+	}
+	return a.openFile()
+}
+
+//---------------------------------------------------------------------------------
+// write()  --  Add a record to the audit log.
+func (a *auditLog) write(rec *auditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.w == nil {
+		return
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		log.Error("Cannot encode audit record: " + err.Error())
+		return
+	}
+	b = append(b, '\n')
+	if a.f != nil && a.size > 0 && a.size+int64(len(b)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			log.Error("Cannot rotate audit log '" + a.cfg.Output + "': " + err.Error())
+		}
+		if a.w == nil {
+			return
+		}
+	}
+	n, err := a.w.Write(b)
+	a.size += int64(n)
+	if err != nil {
+		log.Error("Cannot write audit log: " + err.Error())
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// readAudit()  --  Decode each line of an audit file.
+func readAudit(t *testing.T, fn string) []auditRecord {
+	f, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []auditRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: bad line %q: %v", fn, sc.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestAuditWrite(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "audit.log")
+	a := &auditLog{}
+	if err := a.open(AuditConfig{Output: fn}); err != nil {
+		t.Fatal(err)
+	}
+	a.write(&auditRecord{Kind: "evaluation", Target: "web", CurrentReplicas: 2, DesiredReplicas: 3, Action: "scale_up"})
+	a.write(&auditRecord{Kind: "evaluation", Target: "web", CurrentReplicas: 3, DesiredReplicas: 3, Action: "none"})
+	// Opening again appends to the same file
+	if err := a.open(AuditConfig{Output: fn}); err != nil {
+		t.Fatal(err)
+	}
+	a.write(&auditRecord{Kind: "drain", Target: "web", Action: "scale_down"})
+
+	recs := readAudit(t, fn)
+	if len(recs) != 3 {
+		t.Fatalf("%d records, want 3", len(recs))
+	}
+	if recs[0].Action != "scale_up" || recs[0].DesiredReplicas != 3 || recs[2].Kind != "drain" {
+		t.Errorf("records = %+v", recs)
+	}
+}
+
+func TestAuditOff(t *testing.T) {
+	a := &auditLog{}
+	if err := a.open(AuditConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	a.write(&auditRecord{Target: "web"}) // Must not panic with no output
+	if a.w != nil {
+		t.Error("blank output opened a writer")
+	}
+}
+
+func TestAuditRotate(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "audit.log")
+	a := &auditLog{}
+	if err := a.open(AuditConfig{Output: fn, Max_Files: 2}); err != nil {
+		t.Fatal(err)
+	}
+	a.maxSize = 300 // Bytes, so a couple of records fill a file
+	for i := 0; i < 20; i++ {
+		a.write(&auditRecord{Target: "web", Reason: strconv.Itoa(i), Action: "none"})
+	}
+	for _, f := range []string{fn, fn + ".1", fn + ".2"} {
+		st, err := os.Stat(f)
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+		if st.Size() > a.maxSize {
+			t.Errorf("%s is %d bytes, over the %d limit", f, st.Size(), a.maxSize)
+		}
+	}
+	if _, err := os.Stat(fn + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 kept with max_files 2", fn)
+	}
+	// The newest records are in the current file
+	recs := readAudit(t, fn)
+	if len(recs) == 0 || recs[len(recs)-1].Reason != "19" {
+		t.Errorf("current file has %+v, want record 19 last", recs)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+//
+//  behavior.go
+//   Stabilization Windows and Cooldown used to keep a noisy SLB rate from flapping the Deployment
+//   up and down on every check interval. This works like the 'behavior' section of the Kubernetes HPA:
+//   when scaling up, the lowest recommendation seen during the scale up window is used, and when
+//   scaling down, the highest recommendation seen during the scale down window is used.
+//
+import (
+	"strconv"
+	"time"
+)
+
+// BehaviorConfig is the 'behavior' section of the config file. All values are in seconds.
+type BehaviorConfig struct {
+	ScaleUpWindow   time.Duration `yaml:"scale_up_window"`
+	ScaleDownWindow time.Duration `yaml:"scale_down_window"`
+	Cooldown        time.Duration `yaml:"cooldown"`
+}
+
+type recommendation struct {
+	at       time.Time
+	replicas int
+}
+
+// stabilizer keeps the recent recommendations and the time of the last scaling action.
+type stabilizer struct {
+	cfg       BehaviorConfig
+	recs      []recommendation
+	lastScale time.Time
+}
+
+func newStabilizer(cfg BehaviorConfig) *stabilizer {
+	return &stabilizer{cfg: cfg}
+}
+
+//---------------------------------------------------------------------------------
+// stabilize()  --  Record the Scaling Policy recommendation and return the number of Replicas that
+// should actually be used after looking back over the stabilization windows.
+func (s *stabilizer) stabilize(now time.Time, rpl int, current int) (int, string) {
+	s.recs = append(s.recs, recommendation{at: now, replicas: rpl})
+
+	// Drop anything older than the longest window
+	keep := s.cfg.ScaleUpWindow
+	if s.cfg.ScaleDownWindow > keep {
+		keep = s.cfg.ScaleDownWindow
+	}
+	cutoff := now.Add(-keep * time.Second)
+	i := 0
+	for i < len(s.recs)-1 && s.recs[i].at.Before(cutoff) {
+		i++
+	}
+	s.recs = s.recs[i:]
+
+	switch {
+	case rpl > current:
+		// Scaling up: use the lowest recommendation in the window, but never go below current.
+		n := s.lowest(now.Add(-s.cfg.ScaleUpWindow * time.Second))
+		if n < current {
+			n = current
+		}
+		if n != rpl {
+			return n, "scale up stabilized to " + strconv.Itoa(n) + " over " + strconv.Itoa(int(s.cfg.ScaleUpWindow)) + "s window"
+		}
+	case rpl < current:
+		// Scaling down: use the highest recommendation in the window, but never go above current.
+		n := s.highest(now.Add(-s.cfg.ScaleDownWindow * time.Second))
+		if n > current {
+			n = current
+		}
+		if n != rpl {
+			return n, "scale down stabilized to " + strconv.Itoa(n) + " over " + strconv.Itoa(int(s.cfg.ScaleDownWindow)) + "s window"
+		}
+	}
+	return rpl, ""
+}
+
+func (s *stabilizer) lowest(since time.Time) int {
+	n := s.recs[len(s.recs)-1].replicas
+	for _, r := range s.recs {
+		if !r.at.Before(since) && r.replicas < n {
+			n = r.replicas
+		}
+	}
+	return n
+}
+
+func (s *stabilizer) highest(since time.Time) int {
+	n := s.recs[len(s.recs)-1].replicas
+	for _, r := range s.recs {
+		if !r.at.Before(since) && r.replicas > n {
+			n = r.replicas
+		}
+	}
+	return n
+}
+
+//---------------------------------------------------------------------------------
+// inCooldown()  --  True if the last scaling action was less than 'cooldown' seconds ago.
+func (s *stabilizer) inCooldown(now time.Time) bool {
+	if s.cfg.Cooldown == 0 || s.lastScale.IsZero() {
+		return false
+	}
+	return now.Before(s.lastScale.Add(s.cfg.Cooldown * time.Second))
+}
+
+// scaled()  --  Record that a scaling action was taken.
+func (s *stabilizer) scaled(now time.Time) {
+	s.lastScale = now
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStabilize(t *testing.T) {
+	type step struct {
+		at      int // Seconds from the start
+		rpl     int // Recommendation
+		current int
+		want    int
+	}
+	tests := []struct {
+		name  string
+		cfg   BehaviorConfig
+		steps []step
+	}{
+		{"no windows", BehaviorConfig{}, []step{
+			{0, 5, 3, 5},
+			{10, 2, 5, 2},
+		}},
+		{"scale down uses highest in window", BehaviorConfig{ScaleDownWindow: 60}, []step{
+			{0, 8, 8, 8},
+			{10, 6, 8, 8},
+			{20, 4, 8, 8},
+			{70, 4, 8, 6}, // 8 at 0s has left the window
+			{80, 4, 8, 4},
+		}},
+		{"scale down never goes above current", BehaviorConfig{ScaleDownWindow: 60}, []step{
+			{0, 10, 5, 10},
+			{10, 4, 6, 6},
+		}},
+		{"scale up uses lowest in window", BehaviorConfig{ScaleUpWindow: 30}, []step{
+			{0, 3, 3, 3},
+			{10, 6, 3, 3},
+			{20, 8, 3, 3},
+			{31, 8, 3, 6},
+			{41, 8, 3, 8}, // 6 at 10s has left the window
+		}},
+		{"scale up never goes below current", BehaviorConfig{ScaleUpWindow: 30}, []step{
+			{0, 2, 4, 2},
+			{10, 6, 5, 5},
+		}},
+	}
+	t0 := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		s := newStabilizer(tt.cfg)
+		for _, st := range tt.steps {
+			got, why := s.stabilize(t0.Add(time.Duration(st.at)*time.Second), st.rpl, st.current)
+			if got != st.want {
+				t.Errorf("%s: at %ds stabilize(%d, %d) = %d (%s), want %d", tt.name, st.at, st.rpl, st.current, got, why, st.want)
+			}
+		}
+	}
+}
+
+func TestCooldown(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	s := newStabilizer(BehaviorConfig{Cooldown: 30})
+	if s.inCooldown(t0) {
+		t.Error("inCooldown() before any scaling = true")
+	}
+	s.scaled(t0)
+	for _, tt := range []struct {
+		after int
+		want  bool
+	}{{0, true}, {29, true}, {30, false}, {60, false}} {
+		if got := s.inCooldown(t0.Add(time.Duration(tt.after) * time.Second)); got != tt.want {
+			t.Errorf("inCooldown() %ds after scaling = %v, want %v", tt.after, got, tt.want)
+		}
+	}
+	s = newStabilizer(BehaviorConfig{})
+	s.scaled(t0)
+	if s.inCooldown(t0) {
+		t.Error("inCooldown() with no cooldown = true")
+	}
+}
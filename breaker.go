@@ -0,0 +1,141 @@
+package main
+
+//
+//  breaker.go
+//   Retries & circuit breakers for the Thunder and Kubernetes APIs. Calls that fail in a way that may
+//   clear up by itself are retried by the clients with a jittered backoff. If calls to an API keep
+//   failing anyway, its circuit breaker opens and the API is left alone: while the Thunder's is open
+//   every Target is in degraded mode (see degraded.go), and while the Kubernetes one is open every
+//   Target holds its current Replicas. Once 'open_for' has passed, one Target is let through to try
+//   again, and the first answer from the API closes the breaker.
+//
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8sgo"
+
+	"a10/axapi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryConfig is the 'retry' section of the config file.
+type RetryConfig struct {
+	Attempts    int           `yaml:"attempts"`    // Tries per call, including the first
+	Backoff     time.Duration `yaml:"backoff"`     // Seconds before the first retry, doubled for each one after
+	Max_Backoff time.Duration `yaml:"max_backoff"` // Longest wait between tries, in seconds
+}
+
+// BreakerConfig is the 'circuit_breaker' section of the config file.
+type BreakerConfig struct {
+	Failures int           `yaml:"failures"` // Failed calls in a row that open the breaker
+	Open_For time.Duration `yaml:"open_for"` // Seconds to hold scaling before trying the API again
+}
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = 1
+	defaultRetryMaxBackoff = 10
+	defaultBreakerFailures = 3
+	defaultBreakerOpenFor  = 30
+)
+
+//---------------------------------------------------------------------------------
+// axapiRetry() / k8sRetry()  --  The 'retry' section as the clients want it, with defaults filled in.
+func (rc RetryConfig) axapiRetry() axapi.Retry {
+	if rc.Attempts == 0 {
+		rc.Attempts = defaultRetryAttempts
+	}
+	if rc.Backoff == 0 {
+		rc.Backoff = defaultRetryBackoff
+	}
+	if rc.Max_Backoff == 0 {
+		rc.Max_Backoff = defaultRetryMaxBackoff
+	}
+	return axapi.Retry{Attempts: rc.Attempts, Backoff: rc.Backoff * time.Second, Max: rc.Max_Backoff * time.Second}
+}
+
+func (rc RetryConfig) k8sRetry() k8sgo.Retry {
+	r := rc.axapiRetry()
+	return k8sgo.Retry{Attempts: r.Attempts, Backoff: r.Backoff, Max: r.Max}
+}
+
+// circuitBreaker tracks the calls made to one API.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	api      string    // "axapi" or "k8s", as passed to observeCall()
+	name     string    // For the logs
+	failures int       // Failed calls in a row
+	lastErr  string    // Of the last failed call
+	openedAt time.Time // Zero while closed; moved on each time a Target is let through to try again
+}
+
+var errBreakerOpen = errors.New("circuit breaker open")
+
+var breakers = map[string]*circuitBreaker{
+	"axapi": {api: "axapi", name: "Thunder"},
+	"k8s":   {api: "k8s", name: "Kubernetes"},
+}
+
+// unavailable()  --  True if the error says the API could not be reached or is not working, rather
+// than that it turned the call down (404, a bad request, ...).
+func unavailable(err error) bool {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return true // Network error or timeout
+	}
+	s := err.Error()
+	return len(s) > 4 && s[3] == ' ' && (s[0] == '5' || strings.HasPrefix(s, "429"))
+}
+
+//---------------------------------------------------------------------------------
+// called()  --  Count a call made to the API. Any answer from the API closes the breaker.
+func (b *circuitBreaker) called(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil && unavailable(err) {
+		b.failures++
+		b.lastErr = err.Error()
+		return
+	}
+	b.failures = 0
+	if !b.openedAt.IsZero() {
+		b.openedAt = time.Time{}
+		log.Info(b.name + " API is answering again, circuit breaker closed")
+		prom.set("a10_autoscaler_circuit_breaker_open", promLabels("api", b.api), 0)
+	}
+}
+
+// allow()  --  False while the breaker is open, and the API should be left alone. Opens the breaker
+// once 'failures' calls in a row have failed.
+func (b *circuitBreaker) allow(bc BreakerConfig, now time.Time) bool {
+	if bc.Failures == 0 {
+		bc.Failures = defaultBreakerFailures
+	}
+	if bc.Open_For == 0 {
+		bc.Open_For = defaultBreakerOpenFor
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		if b.failures < bc.Failures {
+			return true
+		}
+		b.openedAt = now
+		log.Warn(b.name + " API circuit breaker open after " + strconv.Itoa(b.failures) + " failed calls in a row: " + b.lastErr)
+		prom.set("a10_autoscaler_circuit_breaker_open", promLabels("api", b.api), 1)
+		prom.add("a10_autoscaler_circuit_breaker_opened_total", promLabels("api", b.api), 1)
+		return false
+	}
+	if now.Sub(b.openedAt) >= bc.Open_For*time.Second {
+		b.openedAt = now // Half open: let this one through, and wait again if it fails too
+		log.Info("Trying the " + b.name + " API again")
+		return true
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestUnavailable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&url.Error{Op: "Get", URL: "https://x", Err: errors.New("connection refused")}, true},
+		{errors.New("503 Service Unavailable"), true},
+		{errors.New("500 Internal Server Error"), true},
+		{errors.New("429 Too Many Requests"), true},
+		{errors.New("404 Not Found"), false},
+		{errors.New("409 Conflict"), false},
+		{errors.New("5"), false},
+		{errors.New("No A10 Auth Token! You must Login() before calling other API calls"), false},
+	}
+	for _, tt := range tests {
+		if got := unavailable(tt.err); got != tt.want {
+			t.Errorf("unavailable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	down := errors.New("503 Service Unavailable")
+	type step struct {
+		at    int   // Seconds from the start
+		err   error // Result of the call, made if the breaker allows it
+		allow bool
+	}
+	tests := []struct {
+		name  string
+		cfg   BreakerConfig
+		steps []step
+	}{
+		{"closed while calls work", BreakerConfig{}, []step{
+			{0, nil, true},
+			{10, nil, true},
+		}},
+		{"opens after failures in a row", BreakerConfig{Failures: 2, Open_For: 30}, []step{
+			{0, down, true},
+			{10, down, true},
+			{20, nil, false},
+			{40, nil, false}, // Still inside open_for
+			{50, nil, true},  // Half open, and the call works
+			{60, nil, true},
+		}},
+		{"half open call fails", BreakerConfig{Failures: 1, Open_For: 30}, []step{
+			{0, down, true},
+			{10, nil, false},
+			{40, down, true},
+			{50, nil, false}, // Waits open_for again
+			{70, nil, true},
+		}},
+		{"other errors reset the count", BreakerConfig{Failures: 2, Open_For: 30}, []step{
+			{0, down, true},
+			{10, errors.New("404 Not Found"), true},
+			{20, down, true},
+			{30, nil, true},
+		}},
+		{"defaults", BreakerConfig{}, []step{
+			{0, down, true},
+			{10, down, true},
+			{20, down, true},
+			{30, nil, false},
+			{59, nil, false},
+			{60, nil, true},
+		}},
+	}
+	t0 := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		b := &circuitBreaker{api: "test", name: "Test"}
+		for _, st := range tt.steps {
+			ok := b.allow(tt.cfg, t0.Add(time.Duration(st.at)*time.Second))
+			if ok != st.allow {
+				t.Errorf("%s: at %ds allow() = %v, want %v", tt.name, st.at, ok, st.allow)
+			}
+			if ok {
+				b.called(st.err)
+			}
+		}
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	tests := []struct {
+		rc                  RetryConfig
+		attempts            int
+		backoff, maxBackoff time.Duration
+	}{
+		{RetryConfig{}, 3, time.Second, 10 * time.Second},
+		{RetryConfig{Attempts: 1, Backoff: 2, Max_Backoff: 60}, 1, 2 * time.Second, time.Minute},
+	}
+	for _, tt := range tests {
+		a := tt.rc.axapiRetry()
+		k := tt.rc.k8sRetry()
+		if a.Attempts != tt.attempts || a.Backoff != tt.backoff || a.Max != tt.maxBackoff {
+			t.Errorf("%+v.axapiRetry() = %+v", tt.rc, a)
+		}
+		if k.Attempts != a.Attempts || k.Backoff != a.Backoff || k.Max != a.Max {
+			t.Errorf("%+v.k8sRetry() = %+v, want the same as axapiRetry() %+v", tt.rc, k, a)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+//
+//  clients.go
+//   The Thunder & Kubernetes calls the scaling code makes. In normal use these are an axapi.Device and
+//   a k8sgo.Cluster; the 'simulate' command swaps in recorded stats and a pretend Deployment instead.
+//   Every call is made with a Context that gives up after 'cmd_timeout', so a hung Thunder management
+//   plane or API Server cannot stall the processing loop.
+//
+import (
+	"context"
+	"time"
+
+	"k8sgo"
+
+	"a10/axapi"
+)
+
+// thunderAPI is what procLoop() needs from the Thunder ADC.
+type thunderAPI interface {
+	GetVSPortStatsCtx(ctx context.Context, vs string, p string) (axapi.PortStats, error)
+	GetServiceGroupsCtx(ctx context.Context) ([]axapi.SvcGrp, error)
+	GetSLBserversCtx(ctx context.Context) ([]axapi.Server, error)
+	GetMemberStatsCtx(ctx context.Context, sg string, m axapi.Member) (axapi.MemberStats, error)
+	DisableMemberCtx(ctx context.Context, sg string, m axapi.Member) error
+	EnableMemberCtx(ctx context.Context, sg string, m axapi.Member) error
+	GetHostnameCtx(ctx context.Context) (axapi.Device, error)
+}
+
+// clusterAPI is what procLoop() needs from the Kubernetes Cluster.
+type clusterAPI interface {
+	GetDeploymentStatusCtx(ctx context.Context, dep string, ns string) (k8sgo.Deployment, error)
+	AdjustDeploymentCtx(ctx context.Context, d k8sgo.Deployment, num int) (k8sgo.Deployment, error)
+	GetDeploymentPodsCtx(ctx context.Context, d k8sgo.Deployment) ([]k8sgo.Pod, error)
+	SetPodDeletionCostCtx(ctx context.Context, p k8sgo.Pod, cost int) error
+	ClearPodDeletionCostCtx(ctx context.Context, p k8sgo.Pod) error
+	DeletePodCtx(ctx context.Context, p k8sgo.Pod) error
+	CreateEventCtx(ctx context.Context, e k8sgo.Event) error
+	ListCustomObjectsCtx(ctx context.Context, r k8sgo.CustomResource, ns string) ([]k8sgo.CustomObject, error)
+	PatchCustomObjectStatusCtx(ctx context.Context, r k8sgo.CustomResource, o k8sgo.CustomObject, status []byte) error
+}
+
+var _ thunderAPI = axapi.Device{}
+var _ clusterAPI = k8sgo.Cluster{}
+
+//---------------------------------------------------------------------------------
+// callCtx()  --  Context for a single Thunder or Kubernetes call, cancelled with 'ctx' or after
+// 'cmd_timeout', whichever comes first. A 'cmd_timeout' of 0 sets no time limit.
+func callCtx(ctx context.Context, cfg Configuration) (context.Context, context.CancelFunc) {
+	if cfg.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, cfg.Timeout*time.Second)
+}
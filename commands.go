@@ -0,0 +1,59 @@
+package main
+
+//
+//  commands.go
+//   Commands other than running the autoscaler, ie.
+//     a10-autoscaler-k8s validate -config ./config.yaml
+//     a10-autoscaler-k8s simulate -config ./config.yaml -data stats.jsonl.gz
+//     a10-autoscaler-k8s record -config ./config.yaml -user admin -out stats.jsonl.gz
+//
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+//---------------------------------------------------------------------------------
+// runCommand()  --  Run the named command and return the exit code for the program.
+func runCommand(cmd string, args []string) int {
+	switch cmd {
+	case "validate":
+		return cmdValidate(args)
+	case "simulate":
+		return cmdSimulate(args)
+	case "record":
+		return cmdRecord(args)
+	}
+	fmt.Fprintln(os.Stderr, "Unknown command '"+cmd+"'. Commands are: validate, simulate, record")
+	return 2
+}
+
+//---------------------------------------------------------------------------------
+// cmdValidate()  --  Check a config file and print every problem found, with line numbers.
+func cmdValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fn := fs.String("config", "./config.yaml", "Configuration File Path")
+	fs.Parse(args)
+
+	raw, err := ioutil.ReadFile(*fn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	_, errs := validateConfig(raw)
+	if len(errs) == 0 {
+		fmt.Println(*fn + ": OK")
+		return 0
+	}
+	for _, e := range errs {
+		loc := *fn
+		if e.Line > 0 {
+			loc = loc + ":" + strconv.Itoa(e.Line)
+		}
+		e.Line = 0
+		fmt.Println(loc + ": " + e.String())
+	}
+	return 1
+}
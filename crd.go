@@ -0,0 +1,321 @@
+package main
+
+//
+//  crd.go
+//   A10Autoscaler Custom Resources, so app teams can set up scaling for their own Deployments without
+//   touching the agent's config file. The resources are listed on every pass of procLoop(), turned into
+//   Scale Targets that go through the same scaling code as the ones in the config file, and have the
+//   outcome written back to their status. (See a10autoscaler-crd.yaml for the CRD & an example.)
+//
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"k8sgo"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CRDConfig is the 'custom_resources' section of the config file.
+type CRDConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Namespace string `yaml:"namespace"` // Only use A10Autoscalers in this namespace; blank for all
+}
+
+var a10AutoscalerResource = k8sgo.CustomResource{
+	Group:   "autoscaling.a10networks.com",
+	Version: "v1alpha1",
+	Plural:  "a10autoscalers",
+}
+
+// a10AutoscalerSpec is the 'spec' of an A10Autoscaler. Settings it leaves out come from the top
+// level of the config file, the same as for Targets in the file.
+type a10AutoscalerSpec struct {
+	ScaleTargetRef struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Name       string `json:"name"`
+	} `json:"scaleTargetRef"`
+	Thunder struct {
+		VIP  string `json:"vip"`
+		Port string `json:"port"` // ie. "80+http"
+	} `json:"thunder"`
+	MinReplicas int            `json:"minReplicas"`
+	MaxReplicas int            `json:"maxReplicas"`
+	Metrics     []MetricConfig `json:"metrics"`
+	Policy      PolicyConfig   `json:"policy"`
+	Behavior    BehaviorConfig `json:"behavior"`
+	RateSource  string         `json:"rateSource"`
+	DryRun      bool           `json:"dryRun"`
+}
+
+// a10AutoscalerStatus is the 'status' written back to an A10Autoscaler.
+type a10AutoscalerStatus struct {
+	ObservedGeneration int64       `json:"observedGeneration"`
+	CurrentReplicas    int         `json:"currentReplicas"`
+	SimulatedReplicas  int         `json:"simulatedReplicas,omitempty"` // dryRun only
+	DesiredReplicas    int         `json:"desiredReplicas"`
+	LastScaleTime      string      `json:"lastScaleTime,omitempty"`
+	Conditions         []condition `json:"conditions"`
+}
+
+type condition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"` // "True" or "False"
+	Reason             string `json:"reason"`
+	Message            string `json:"message"`
+	LastTransitionTime string `json:"lastTransitionTime"`
+}
+
+// crTarget is a Scale Target made from an A10Autoscaler.
+type crTarget struct {
+	obj     k8sgo.CustomObject
+	t       *Target // nil while the spec is not valid
+	specErr string
+	conds   []condition
+	status  []byte // Last status written
+}
+
+// controller keeps the A10Autoscalers seen, by namespace/name.
+type controller struct {
+	crs map[string]*crTarget
+}
+
+var crds = &controller{crs: make(map[string]*crTarget)}
+
+//---------------------------------------------------------------------------------
+// crTargetConfig()  --  Decode & check the spec of an A10Autoscaler, and turn it into Target settings.
+func crTargetConfig(cfg Configuration, o k8sgo.CustomObject) (TargetConfig, error) {
+	var sp a10AutoscalerSpec
+	if err := json.Unmarshal(o.Spec, &sp); err != nil {
+		return TargetConfig{}, errors.New("spec: " + err.Error())
+	}
+	ref := sp.ScaleTargetRef
+	if ref.Kind != "Deployment" || (ref.APIVersion != "" && ref.APIVersion != "apps/v1") {
+		return TargetConfig{}, errors.New("spec.scaleTargetRef: only apps/v1 Deployments can be scaled")
+	}
+	if len(sp.Metrics) == 0 {
+		return TargetConfig{}, errors.New("spec.metrics: at least one metric is required")
+	}
+	tc := TargetConfig{
+		Name:        o.Namespace + "/" + o.Name,
+		SLB:         sp.Thunder.VIP,
+		SLB_Port:    sp.Thunder.Port,
+		Deployment:  ref.Name,
+		Namespace:   o.Namespace,
+		Min_Pods:    sp.MinReplicas,
+		Max_Pods:    sp.MaxReplicas,
+		Metrics:     sp.Metrics,
+		Policy:      sp.Policy,
+		Behavior:    sp.Behavior,
+		Rate_Source: sp.RateSource,
+		Dry_Run:     sp.DryRun,
+	}
+
+	// Same checks as a Target in the config file, reported with the spec's field names
+	paths := map[string]string{
+		"slb": "spec.thunder.vip", "slb_port": "spec.thunder.port", "deployment": "spec.scaleTargetRef.name",
+		"namespace": "metadata.namespace", "min_pods": "spec.minReplicas", "max_pods": "spec.maxReplicas",
+	}
+	v := &validator{}
+	v.checkTarget(func(k string) string {
+		if strings.HasPrefix(k, "metrics.") {
+			return "spec." + k
+		}
+		return paths[k]
+	}, tc, false)
+	v.checkPolicy("spec.policy", tc.Policy)
+	if err := checkRateSource(tc.Rate_Source); err != nil {
+		v.add("spec.rateSource", err.Error())
+	}
+	v.seconds("spec.behavior.scaleUpWindow", tc.Behavior.ScaleUpWindow, 0, maxDay)
+	v.seconds("spec.behavior.scaleDownWindow", tc.Behavior.ScaleDownWindow, 0, maxDay)
+	v.seconds("spec.behavior.cooldown", tc.Behavior.Cooldown, 0, maxDay)
+	if len(v.errs) > 0 {
+		var msgs []string
+		for _, e := range v.errs {
+			msgs = append(msgs, e.String())
+		}
+		return TargetConfig{}, errors.New(strings.Join(msgs, "; "))
+	}
+	return cfg.withDefaults(tc), nil
+}
+
+//---------------------------------------------------------------------------------
+// sync()  --  List the A10Autoscalers and return the Targets to scale for them. Targets are rebuilt
+// every pass, so changes to a resource or to the config file defaults are picked up right away, but
+// keep their history, cooldown and drain state.
+func (ct *controller) sync(ctx context.Context, c clusterAPI, cfg Configuration) []*Target {
+	start := time.Now()
+	cctx, cancel := callCtx(ctx, cfg)
+	objs, err := c.ListCustomObjectsCtx(cctx, a10AutoscalerResource, cfg.CRD.Namespace)
+	cancel()
+	observeCall("k8s", "ListCustomObjects", start, err)
+	if err != nil {
+		log.Error("Cannot list A10Autoscalers, using the ones already known: " + err.Error())
+		return ct.targets()
+	}
+
+	inFile := make(map[string]bool)
+	for _, tc := range cfg.targetConfigs() {
+		inFile[tc.Name] = true
+	}
+	seen := make(map[string]bool)
+	for _, o := range objs {
+		key := o.Namespace + "/" + o.Name
+		seen[key] = true
+		cr, ok := ct.crs[key]
+		if !ok || cr.obj.UID != o.UID {
+			if ok && cr.t != nil {
+				prom.forget(cr.t.Cfg.Name) // Deleted & created again
+			}
+			log.Info("A10Autoscaler '" + key + "' added")
+			cr = &crTarget{}
+			ct.crs[key] = cr
+		} else if cr.obj.Generation != o.Generation {
+			log.Info("A10Autoscaler '" + key + "' changed")
+		}
+		cr.obj = o
+
+		tc, err := crTargetConfig(cfg, o)
+		if err == nil && inFile[tc.Name] {
+			err = errors.New("has the same name as a Target in the config file")
+		}
+		var t *Target
+		if err == nil {
+			t, err = newTarget(cfg, tc)
+		}
+		if err != nil {
+			if err.Error() != cr.specErr {
+				log.Error("A10Autoscaler '" + key + "' is not valid, not scaling it: " + err.Error())
+			}
+			cr.specErr = err.Error()
+			if cr.t != nil {
+				prom.forget(cr.t.Cfg.Name)
+				cr.t = nil
+			}
+			continue
+		}
+		cr.specErr = ""
+		if cr.t == nil {
+			cr.t = t
+		} else {
+			cr.t.update(t)
+		}
+	}
+
+	for key, cr := range ct.crs {
+		if !seen[key] {
+			log.Info("A10Autoscaler '" + key + "' deleted")
+			if cr.t != nil {
+				prom.forget(cr.t.Cfg.Name)
+			}
+			delete(ct.crs, key)
+		}
+	}
+	return ct.targets()
+}
+
+// keys()  --  namespace/names of the A10Autoscalers, in order.
+func (ct *controller) keys() []string {
+	var keys []string
+	for k := range ct.crs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// targets()  --  The Targets of the A10Autoscalers with a valid spec.
+func (ct *controller) targets() []*Target {
+	var ts []*Target
+	for _, k := range ct.keys() {
+		if t := ct.crs[k].t; t != nil {
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+// stop()  --  Forget the A10Autoscalers after custom_resources is turned off.
+func (ct *controller) stop() {
+	for key, cr := range ct.crs {
+		if cr.t != nil {
+			prom.forget(cr.t.Cfg.Name)
+		}
+		delete(ct.crs, key)
+	}
+}
+
+//---------------------------------------------------------------------------------
+// writeStatus()  --  Write what the last pass saw & decided back to each A10Autoscaler. Only
+// resources whose status has changed are updated.
+func (ct *controller) writeStatus(ctx context.Context, c clusterAPI, cfg Configuration, now time.Time) {
+	for _, key := range ct.keys() {
+		cr := ct.crs[key]
+		st := a10AutoscalerStatus{ObservedGeneration: cr.obj.Generation}
+		t := cr.t
+		switch {
+		case t == nil:
+			cr.setCondition("AbleToScale", "False", "InvalidSpec", cr.specErr, now)
+		case t.lastErr != "":
+			cr.setCondition("AbleToScale", "False", "FailedGetMetrics", t.lastErr, now)
+		case t.isDraining():
+			cr.setCondition("AbleToScale", "True", "Draining", "Waiting for Pods to drain before scaling down", now)
+		default:
+			cr.setCondition("AbleToScale", "True", "Ready", "Metrics and Deployment are available", now)
+		}
+		if t != nil {
+			st.CurrentReplicas = t.current
+			st.SimulatedReplicas = t.simulated
+			st.DesiredReplicas = t.desired
+			if !t.st.lastScale.IsZero() {
+				st.LastScaleTime = t.st.lastScale.UTC().Format(time.RFC3339)
+			}
+			switch t.clamped {
+			case "min":
+				cr.setCondition("ScalingLimited", "True", "TooFewReplicas", "Desired Replicas held to minReplicas", now)
+			case "max":
+				cr.setCondition("ScalingLimited", "True", "TooManyReplicas", "Desired Replicas held to maxReplicas", now)
+			default:
+				cr.setCondition("ScalingLimited", "False", "DesiredWithinRange", "Desired Replicas are within range", now)
+			}
+		}
+		st.Conditions = cr.conds
+
+		b, _ := json.Marshal(st)
+		if bytes.Equal(b, cr.status) {
+			continue
+		}
+		start := time.Now()
+		cctx, cancel := callCtx(ctx, cfg)
+		err := c.PatchCustomObjectStatusCtx(cctx, a10AutoscalerResource, cr.obj, b)
+		cancel()
+		observeCall("k8s", "PatchCustomObjectStatus", start, err)
+		if err != nil {
+			log.Error("Cannot update status of A10Autoscaler '" + key + "': " + err.Error())
+			continue
+		}
+		cr.status = b
+	}
+}
+
+// setCondition()  --  Set a status condition, keeping its transition time if the status has not changed.
+func (cr *crTarget) setCondition(typ string, status string, reason string, msg string, now time.Time) {
+	nc := condition{Type: typ, Status: status, Reason: reason, Message: msg, LastTransitionTime: now.UTC().Format(time.RFC3339)}
+	for i, c := range cr.conds {
+		if c.Type == typ {
+			if c.Status == status {
+				nc.LastTransitionTime = c.LastTransitionTime
+			}
+			cr.conds[i] = nc
+			return
+		}
+	}
+	cr.conds = append(cr.conds, nc)
+}
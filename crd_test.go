@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8sgo"
+)
+
+const crdSpec = `{"scaleTargetRef":{"apiVersion":"apps/v1","kind":"Deployment","name":"webserver"},` +
+	`"thunder":{"vip":"ws-vip","port":"80+http"},"minReplicas":1,"maxReplicas":10,` +
+	`"metrics":[{"type":"curr_conn","target":100}],"behavior":{"scaleDownWindow":300}}`
+
+func TestCRTargetConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want string // Error, if any
+	}{
+		{"valid", crdSpec, ""},
+		{"not a Deployment", strings.Replace(crdSpec, `"kind":"Deployment"`, `"kind":"StatefulSet"`, 1),
+			"spec.scaleTargetRef: only apps/v1 Deployments can be scaled"},
+		{"no metrics", strings.Replace(crdSpec, `"metrics":[{"type":"curr_conn","target":100}]`, `"metrics":[]`, 1),
+			"spec.metrics: at least one metric is required"},
+		{"bad port", strings.Replace(crdSpec, `"80+http"`, `"80"`, 1), "spec.thunder.port"},
+		{"min over max", strings.Replace(crdSpec, `"minReplicas":1`, `"minReplicas":20`, 1), "spec.minReplicas"},
+		{"unknown metric", strings.Replace(crdSpec, `"curr_conn"`, `"bogus"`, 1), "spec.metrics.0"},
+		{"bad rate source", strings.Replace(crdSpec, `"minReplicas"`, `"rateSource":"bytes","minReplicas"`, 1), "spec.rateSource"},
+		{"negative window", strings.Replace(crdSpec, `"scaleDownWindow":300`, `"scaleDownWindow":-1`, 1),
+			"spec.behavior.scaleDownWindow: must be 0-86400 seconds"},
+		{"window in nanoseconds", strings.Replace(crdSpec, `"scaleDownWindow":300`, `"scaleDownWindow":300000000000`, 1),
+			"spec.behavior.scaleDownWindow: must be 0-86400 seconds"},
+		{"not JSON", `{"scaleTargetRef":`, "spec: "},
+	}
+	for _, tt := range tests {
+		o := k8sgo.CustomObject{Name: "web", Namespace: "cyan", Spec: []byte(tt.spec)}
+		tc, err := crTargetConfig(Configuration{}, o)
+		if tt.want != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tc.Name != "cyan/web" || tc.Deployment != "webserver" || tc.Namespace != "cyan" || tc.SLB != "ws-vip" ||
+			tc.Max_Pods != 10 || len(tc.Metrics) != 1 || tc.Metrics[0].Target != 100 || tc.Behavior.ScaleDownWindow != 300 {
+			t.Errorf("%s: crTargetConfig() = %+v", tt.name, tc)
+		}
+	}
+}
+
+func TestSetCondition(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	cr := &crTarget{}
+	cr.setCondition("AbleToScale", "True", "Ready", "ok", t0)
+	cr.setCondition("AbleToScale", "True", "Draining", "draining", t0.Add(time.Minute))
+	if len(cr.conds) != 1 || cr.conds[0].Reason != "Draining" || cr.conds[0].LastTransitionTime != t0.UTC().Format(time.RFC3339) {
+		t.Errorf("same status: conds = %+v, want the reason changed and the transition time kept", cr.conds)
+	}
+	cr.setCondition("AbleToScale", "False", "InvalidSpec", "bad", t0.Add(2*time.Minute))
+	if cr.conds[0].LastTransitionTime != t0.Add(2*time.Minute).UTC().Format(time.RFC3339) {
+		t.Errorf("new status: conds = %+v, want a new transition time", cr.conds)
+	}
+	cr.setCondition("ScalingLimited", "False", "DesiredWithinRange", "", t0)
+	if len(cr.conds) != 2 {
+		t.Errorf("conds = %+v, want 2", cr.conds)
+	}
+}
+
+func TestControllerSync(t *testing.T) {
+	const list = "GET /apis/autoscaling.a10networks.com/v1alpha1/a10autoscalers"
+	items := func(objs ...string) fakeReply {
+		return fakeReply{200, `{"items":[` + strings.Join(objs, ",") + `]}`}
+	}
+	web := `{"metadata":{"name":"web","namespace":"cyan","uid":"u1","generation":1},"spec":` + crdSpec + `}`
+	bad := `{"metadata":{"name":"bad","namespace":"cyan","uid":"u2","generation":1},"spec":{"scaleTargetRef":{"kind":"Deployment","name":"x"}}}`
+	f, c := newFakeK8s(t, map[string]fakeReply{
+		list: items(web, bad),
+		"PATCH /apis/autoscaling.a10networks.com/v1alpha1/namespaces/cyan/a10autoscalers/web/status": {200, "{}"},
+		"PATCH /apis/autoscaling.a10networks.com/v1alpha1/namespaces/cyan/a10autoscalers/bad/status": {200, "{}"},
+	})
+	ct := &controller{crs: make(map[string]*crTarget)}
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	ts := ct.sync(ctx, c, Configuration{})
+	if len(ts) != 1 || ts[0].Cfg.Name != "cyan/web" {
+		t.Fatalf("sync() = %d Targets, want just cyan/web", len(ts))
+	}
+	ts[0].current, ts[0].desired = 2, 3
+	ct.writeStatus(ctx, c, Configuration{}, now)
+	patches := f.called("PATCH")
+	if len(patches) != 2 {
+		t.Fatalf("%d status patches, want 2", len(patches))
+	}
+	for _, p := range patches {
+		switch {
+		case strings.Contains(p.path, "/bad/"):
+			if !strings.Contains(p.body, `"reason":"InvalidSpec"`) {
+				t.Errorf("bad status = %s, want InvalidSpec", p.body)
+			}
+		case !strings.Contains(p.body, `"currentReplicas":2,"desiredReplicas":3`) || !strings.Contains(p.body, `"reason":"Ready"`):
+			t.Errorf("web status = %s", p.body)
+		}
+	}
+	// Nothing changed, nothing written
+	ct.writeStatus(ctx, c, Configuration{}, now.Add(time.Minute))
+	if n := len(f.called("PATCH")); n != 2 {
+		t.Errorf("%d status patches after no change, want still 2", n)
+	}
+
+	// The same Target is kept across syncs, and dropped when its object is deleted
+	kept := ts[0]
+	f.mu.Lock()
+	f.reply[list] = items(web)
+	f.mu.Unlock()
+	if ts = ct.sync(ctx, c, Configuration{}); len(ts) != 1 || ts[0] != kept {
+		t.Error("sync() replaced an unchanged Target")
+	}
+	if len(ct.crs) != 1 {
+		t.Errorf("%d A10Autoscalers known after one was deleted, want 1", len(ct.crs))
+	}
+	f.mu.Lock()
+	f.reply[list] = items()
+	f.mu.Unlock()
+	if ts = ct.sync(ctx, c, Configuration{}); len(ts) != 0 {
+		t.Errorf("sync() = %d Targets after all were deleted", len(ts))
+	}
+
+	// A failed list keeps the ones known
+	ct.crs["cyan/web"] = &crTarget{t: kept}
+	f.mu.Lock()
+	f.reply[list] = fakeReply{403, "{}"}
+	f.mu.Unlock()
+	if ts = ct.sync(ctx, c, Configuration{}); len(ts) != 1 {
+		t.Errorf("sync() = %d Targets after a failed list, want the 1 known", len(ts))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+//
+//  degraded.go
+//   Degraded mode: what a Target does while it has no stats from the Thunder, either because the
+//   stats call failed or because the Thunder's circuit breaker is open. A failed call must never
+//   look like zero traffic, so by default the Deployment is held at its current Replicas. A Target
+//   can instead fall back to a known 'safe' number of Replicas, or to its max_pods, once the stats
+//   have been missing for 'after' seconds.
+//
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// DegradedConfig is the 'degraded' section of a Target.
+type DegradedConfig struct {
+	Action        string        `yaml:"action"`        // hold (default), safe, or max
+	Safe_Replicas int           `yaml:"safe_replicas"` // Replicas to run for the 'safe' action
+	After         time.Duration `yaml:"after"`         // Seconds without stats before acting; hold until then
+}
+
+const defaultDegradedAfter = 60
+
+// checkDegraded()  --  Make sure the degraded mode settings make sense.
+func checkDegraded(dc DegradedConfig) error {
+	switch dc.Action {
+	case "", "hold", "max":
+	case "safe":
+		if dc.Safe_Replicas < 1 {
+			return errors.New("the 'safe' action needs 'safe_replicas' of at least 1")
+		}
+	default:
+		return errors.New("unknown action '" + dc.Action + "', must be hold, safe or max")
+	}
+	if dc.After < 0 {
+		return errors.New("after cannot be negative")
+	}
+	return nil
+}
+
+//---------------------------------------------------------------------------------
+// degraded()  --  Replicas to scale to while the Target has no stats, given the max_pods in effect.
+// Returns false if the Deployment should hold at its current Replicas.
+func (t *Target) degraded(now time.Time, maxPods int) (int, string, bool) {
+	dc := t.Cfg.Degraded
+	age := now.Sub(t.lastGood).Round(time.Second)
+	after := dc.After * time.Second
+	if after == 0 {
+		after = defaultDegradedAfter * time.Second
+	}
+	why := "no stats for " + age.String()
+	switch {
+	case dc.Action == "safe" && age >= after:
+		return dc.Safe_Replicas, why + ", using safe_replicas " + strconv.Itoa(dc.Safe_Replicas), true
+	case dc.Action == "max" && age >= after:
+		return maxPods, why + ", scaling to max_pods " + strconv.Itoa(maxPods), true
+	}
+	return 0, why + ", holding Replicas", false
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckDegraded(t *testing.T) {
+	tests := []struct {
+		dc DegradedConfig
+		ok bool
+	}{
+		{DegradedConfig{}, true},
+		{DegradedConfig{Action: "hold", After: 30}, true},
+		{DegradedConfig{Action: "max"}, true},
+		{DegradedConfig{Action: "safe", Safe_Replicas: 2}, true},
+		{DegradedConfig{Action: "safe"}, false},
+		{DegradedConfig{Action: "panic"}, false},
+		{DegradedConfig{After: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := checkDegraded(tt.dc); (err == nil) != tt.ok {
+			t.Errorf("checkDegraded(%+v) = %v, want ok %v", tt.dc, err, tt.ok)
+		}
+	}
+}
+
+func TestDegraded(t *testing.T) {
+	tests := []struct {
+		dc    DegradedConfig
+		age   int // Seconds since the last good stats
+		rpl   int
+		acted bool
+	}{
+		{DegradedConfig{}, 600, 0, false},
+		{DegradedConfig{Action: "hold"}, 600, 0, false},
+		{DegradedConfig{Action: "safe", Safe_Replicas: 4}, 59, 0, false}, // Default 'after' is 60s
+		{DegradedConfig{Action: "safe", Safe_Replicas: 4}, 60, 4, true},
+		{DegradedConfig{Action: "max", After: 120}, 90, 0, false},
+		{DegradedConfig{Action: "max", After: 120}, 120, 10, true},
+	}
+	now := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		tg := &Target{Cfg: TargetConfig{Degraded: tt.dc}, lastGood: now.Add(-time.Duration(tt.age) * time.Second)}
+		rpl, why, acted := tg.degraded(now, 10)
+		if rpl != tt.rpl || acted != tt.acted {
+			t.Errorf("%+v after %ds: degraded() = %d, %v (%s), want %d, %v", tt.dc, tt.age, rpl, acted, why, tt.rpl, tt.acted)
+		}
+	}
+}
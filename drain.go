@@ -0,0 +1,423 @@
+package main
+
+//
+//  drain.go
+//   Graceful scale down. Instead of letting Kubernetes pick which Pods to kill (and cut off any
+//   connections in flight to them), pick the Pods ourselves, disable them in the Thunder Service Group
+//   so they get no new connections, wait for their connections to reach zero (or the drain timeout),
+//   then mark them with the lowest pod-deletion-cost so the ReplicaSet removes THOSE PARTICULAR PODS
+//   when the Deployment is scaled down. Any drained Pod still running once the scale down is done is
+//   deleted outright, so it is not left out of service.
+//   This only works when Thunder is sending traffic straight to the Pods (ie. IPinIP tunnels down to
+//   the Pod level). If the Pods cannot be found in the Service Group, we fall back to a plain scale down.
+//
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"k8sgo"
+
+	"a10/axapi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DrainConfig is the 'drain' section of a Target.
+type DrainConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Service_Group string        `yaml:"service_group"` // Thunder Service Group the Pods are members of
+	Timeout       time.Duration `yaml:"timeout"`       // Seconds to wait for connections to reach zero
+	Deletion_Cost int           `yaml:"deletion_cost"` // pod-deletion-cost set on drained Pods
+}
+
+const (
+	defaultDrainTimeout = 300
+	defaultDeletionCost = -1000
+)
+
+var drainPoll = 2 * time.Second // How often to check on the connections left; var for the tests
+
+// States of Target.draining
+const (
+	drainIdle      int32 = iota
+	drainWaiting         // Members disabled, waiting for their connections to finish; can be cancelled
+	drainScaling         // Deployment being scaled down; too late to cancel
+	drainCancelled       // A later pass needs the Pods after all
+)
+
+// drainMember is a Pod along with the Service Group Member that sends traffic to it.
+type drainMember struct {
+	pod    k8sgo.Pod
+	member axapi.Member
+	conns  uint64
+}
+
+//---------------------------------------------------------------------------------
+// isDraining()  --  True while a drain is running for the Target.
+func (t *Target) isDraining() bool {
+	return atomic.LoadInt32(&t.draining) != drainIdle
+}
+
+//---------------------------------------------------------------------------------
+// startDrain()  --  Run drainAndScale() for the Target in its own go routine. procLoop() carries on
+// evaluating the Target meanwhile, and cancels the drain if the Pods turn out to be needed after all.
+// 'last' is when the Target was scaled before this, put back if the drain is cancelled.
+func (t *Target) startDrain(ctx context.Context, d thunderAPI, c clusterAPI, cfg Configuration, lg *log.Entry, y k8sgo.Deployment, rpl int, why string, last time.Time) {
+	atomic.StoreInt32(&t.draining, drainWaiting)
+	stop, done := make(chan struct{}), make(chan struct{})
+	t.stopDrain, t.drainDone, t.preDrain = stop, done, last
+	tc := t.Cfg
+	inflight.Add(1)
+	go func() {
+		defer inflight.Done()
+		defer close(done)
+		drainAndScale(ctx, d, c, cfg, t, tc.Name, lg, tc.Drain, y, rpl, why, stop)
+	}()
+}
+
+//---------------------------------------------------------------------------------
+// cancelDrain()  --  Cancel the Target's drain and wait for it to put the drained Pods back in service.
+// Returns false if it is too late: the Deployment is already being scaled down.
+func (t *Target) cancelDrain() bool {
+	if !atomic.CompareAndSwapInt32(&t.draining, drainWaiting, drainCancelled) {
+		return !t.isDraining()
+	}
+	close(t.stopDrain)
+	<-t.drainDone
+	t.st.lastScale = t.preDrain // Nothing was scaled, so no cooldown from it
+	return true
+}
+
+// stopped()  --  True once a drain has been cancelled.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+//---------------------------------------------------------------------------------
+// pickDrainMembers()  --  Choose 'count' running Pods of the Deployment to remove, least busy first.
+// Pods that are not ready are left out, as the ReplicaSet removes those first whatever their cost.
+func pickDrainMembers(ctx context.Context, d thunderAPI, c clusterAPI, cfg Configuration, y k8sgo.Deployment, sg string, count int) ([]drainMember, error) {
+	start := time.Now()
+	cctx, cancel := callCtx(ctx, cfg)
+	pods, err := c.GetDeploymentPodsCtx(cctx, y)
+	cancel()
+	observeCall("k8s", "GetDeploymentPods", start, err)
+	if err != nil {
+		return nil, err
+	}
+	start = time.Now()
+	cctx, cancel = callCtx(ctx, cfg)
+	sgs, err := d.GetServiceGroupsCtx(cctx)
+	cancel()
+	observeCall("axapi", "GetServiceGroups", start, err)
+	if err != nil {
+		return nil, err
+	}
+	var members []axapi.Member
+	found := false
+	for _, g := range sgs {
+		if g.Name == sg {
+			members = g.Members
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("Service Group '" + sg + "' not found on Thunder")
+	}
+	start = time.Now()
+	cctx, cancel = callCtx(ctx, cfg)
+	servers, err := d.GetSLBserversCtx(cctx)
+	cancel()
+	observeCall("axapi", "GetSLBservers", start, err)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make(map[string]string) // server name -> host IP
+	for _, s := range servers {
+		hosts[s.Name] = s.Host
+	}
+	byIP := make(map[string]axapi.Member)
+	for _, m := range members {
+		if h, ok := hosts[m.Name]; ok {
+			byIP[h] = m
+		} else {
+			byIP[m.Name] = m // Server may be named by its IP
+		}
+	}
+
+	var dms []drainMember
+	for _, p := range pods {
+		if p.Deleting || p.Phase != "Running" || !p.Ready || p.IP == "" {
+			continue
+		}
+		m, ok := byIP[p.IP]
+		if !ok {
+			continue
+		}
+		start = time.Now()
+		cctx, cancel := callCtx(ctx, cfg)
+		ms, err := d.GetMemberStatsCtx(cctx, sg, m)
+		cancel()
+		observeCall("axapi", "GetMemberStats", start, err)
+		if err != nil {
+			return nil, err
+		}
+		dms = append(dms, drainMember{pod: p, member: m, conns: ms.CurrConn})
+	}
+	if len(dms) < count {
+		return nil, errors.New("only " + strconv.Itoa(len(dms)) + " of the Deployment's Pods are members of Service Group '" + sg + "'")
+	}
+	sort.SliceStable(dms, func(i, j int) bool { return dms[i].conns < dms[j].conns })
+	return dms[:count], nil
+}
+
+//---------------------------------------------------------------------------------
+// drainAndScale()  --  Scale the Deployment down to 'rpl' Replicas, draining the Pods to be removed first.
+// Runs in its own go routine (see startDrain()). Closing 'stop' cancels the drain, up until the Deployment
+// is scaled down. The Target's name, logger and drain settings are passed in, as a reload can change
+// t.Cfg while the drain runs.
+func drainAndScale(ctx context.Context, d thunderAPI, c clusterAPI, cfg Configuration, t *Target, name string, lg *log.Entry, dc DrainConfig, y k8sgo.Deployment, rpl int, why string, stop <-chan struct{}) {
+	defer atomic.StoreInt32(&t.draining, drainIdle)
+	rec := &auditRecord{
+		Kind:            "drain",
+		Target:          name,
+		Deployment:      y.Namespace + "/" + y.Name,
+		CurrentReplicas: y.CurrentReplicas,
+		DesiredReplicas: rpl,
+		Reason:          why,
+		Action:          "scale_down",
+	}
+	defer func() {
+		rec.Time = time.Now().UTC().Format(time.RFC3339Nano)
+		audit.write(rec)
+	}()
+	timeout := dc.Timeout
+	if timeout == 0 {
+		timeout = defaultDrainTimeout
+	}
+	cost := dc.Deletion_Cost
+	if cost == 0 {
+		cost = defaultDeletionCost
+	}
+
+	// The Pods are needed after all: put any drained ones back in service, without scaling down
+	var disabled, costed []drainMember
+	cancelled := func() {
+		lg.Info("Scale down of Deployment '" + y.Name + "' cancelled, putting drained Pods back in service")
+		rec.Action, rec.Result = "none", "cancelled, Replicas needed again"
+		clearDeletionCost(c, cfg, lg, costed)
+		enableMembers(d, cfg, lg, dc.Service_Group, disabled)
+	}
+
+	dms, err := pickDrainMembers(ctx, d, c, cfg, y, dc.Service_Group, y.CurrentReplicas-rpl)
+	if err != nil {
+		if !atomic.CompareAndSwapInt32(&t.draining, drainWaiting, drainScaling) {
+			cancelled()
+			return
+		}
+		lg.Warn("Cannot drain Pods of Deployment '" + y.Name + "', scaling down without draining: " + err.Error())
+		rec.Result = "not drained: " + err.Error()
+		if err := adjust(ctx, c, cfg, lg, y, rpl, why); err != nil {
+			rec.Result = rec.Result + "; " + err.Error()
+		}
+		return
+	}
+
+	//
+	// Stop Thunder from sending new connections to the Pods
+	for _, dm := range dms {
+		if stopped(stop) {
+			cancelled()
+			return
+		}
+		start := time.Now()
+		cctx, cancel := callCtx(ctx, cfg)
+		err := d.DisableMemberCtx(cctx, dc.Service_Group, dm.member)
+		cancel()
+		observeCall("axapi", "DisableMember", start, err)
+		if err != nil {
+			lg.Error("Disabling Member '" + dm.member.Name + "' failed, aborting drain: " + err.Error())
+			rec.Action, rec.Result = "error", "disabling Member '"+dm.member.Name+"': "+err.Error()
+			enableMembers(d, cfg, lg, dc.Service_Group, disabled)
+			return
+		}
+		lg.Info("Draining Pod '" + dm.pod.Name + "' (Member '" + dm.member.Name + "', " + strconv.FormatUint(dm.conns, 10) + " connections)")
+		disabled = append(disabled, dm)
+	}
+
+	//
+	// Wait for the connections to finish up
+	deadline := time.Now().Add(timeout * time.Second)
+	for {
+		var left uint64
+		for _, dm := range dms {
+			start := time.Now()
+			cctx, cancel := callCtx(ctx, cfg)
+			ms, err := d.GetMemberStatsCtx(cctx, dc.Service_Group, dm.member)
+			cancel()
+			observeCall("axapi", "GetMemberStats", start, err)
+			if err != nil {
+				lg.Error(err.Error())
+				left++ // Assume still busy
+				continue
+			}
+			left += ms.CurrConn
+		}
+		if left == 0 {
+			lg.Info("Pods of Deployment '" + y.Name + "' drained")
+			break
+		}
+		if time.Now().After(deadline) {
+			lg.Warn("Drain of Deployment '" + y.Name + "' timed out with " + strconv.FormatUint(left, 10) + " connections left")
+			rec.Result = "drain timed out with " + strconv.FormatUint(left, 10) + " connections left; "
+			break
+		}
+		select {
+		case <-ctx.Done():
+			// Shutting down; do not leave the Pods out of service without scaling them away
+			lg.Warn("Shutting down, putting drained Pods of Deployment '" + y.Name + "' back in service")
+			rec.Action, rec.Result = "error", "shut down while draining"
+			enableMembers(d, cfg, lg, dc.Service_Group, disabled)
+			return
+		case <-stop:
+			cancelled()
+			return
+		case <-time.After(drainPoll):
+		}
+	}
+
+	//
+	// Make sure the drained Pods are the ones the ReplicaSet removes
+	for _, dm := range dms {
+		if stopped(stop) {
+			cancelled()
+			return
+		}
+		start := time.Now()
+		cctx, cancel := callCtx(ctx, cfg)
+		err := c.SetPodDeletionCostCtx(cctx, dm.pod, cost)
+		cancel()
+		observeCall("k8s", "SetPodDeletionCost", start, err)
+		if err != nil {
+			lg.Error("Setting pod-deletion-cost on Pod '" + dm.pod.Name + "' failed, aborting scale down: " + err.Error())
+			rec.Action, rec.Result = "error", "setting pod-deletion-cost on Pod '"+dm.pod.Name+"': "+err.Error()
+			clearDeletionCost(c, cfg, lg, costed)
+			enableMembers(d, cfg, lg, dc.Service_Group, disabled)
+			return
+		}
+		costed = append(costed, dm)
+	}
+	if !atomic.CompareAndSwapInt32(&t.draining, drainWaiting, drainScaling) {
+		cancelled()
+		return
+	}
+	if err := adjust(ctx, c, cfg, lg, y, rpl, why); err != nil {
+		rec.Result = rec.Result + err.Error()
+		clearDeletionCost(c, cfg, lg, costed)
+		enableMembers(d, cfg, lg, dc.Service_Group, disabled)
+		return
+	}
+	rec.Result = rec.Result + finishDrain(d, c, cfg, lg, dc.Service_Group, y, rpl, dms)
+}
+
+//---------------------------------------------------------------------------------
+// finishDrain()  --  Once the Deployment is down to 'rpl' Pods, make sure the drained Pods are the
+// ones that went. Another Pod going not ready between the pick and the scale down gets removed ahead
+// of them; a drained Pod left running would stay out of service for good, so it is deleted (it has
+// no connections left), or put back into service if that fails. Returns the result for the audit log.
+func finishDrain(d thunderAPI, c clusterAPI, cfg Configuration, lg *log.Entry, sg string, y k8sgo.Deployment, rpl int, dms []drainMember) string {
+	deadline := time.Now().Add(cfg.Timeout * time.Second)
+	for {
+		start := time.Now()
+		cctx, cancel := callCtx(context.Background(), cfg) // Carries on through a shut down; the Deployment is already scaled down
+		pods, err := c.GetDeploymentPodsCtx(cctx, y)
+		cancel()
+		observeCall("k8s", "GetDeploymentPods", start, err)
+		if err == nil {
+			running := make(map[string]bool)
+			for _, p := range pods {
+				if !p.Deleting {
+					running[p.Name] = true
+				}
+			}
+			if len(running) <= rpl {
+				return deleteSurvivors(d, c, cfg, lg, sg, dms, running)
+			}
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(drainPoll)
+	}
+	// Cannot tell which Pods the ReplicaSet removes; do not leave any drained Pod out of service
+	lg.Warn("Scale down of Deployment '" + y.Name + "' did not finish in time, putting drained Pods back in service")
+	clearDeletionCost(c, cfg, lg, dms)
+	enableMembers(d, cfg, lg, sg, dms)
+	return "scale down did not finish in time, drained Pods put back in service"
+}
+
+// deleteSurvivors()  --  Delete the drained Pods that are still running after the scale down.
+func deleteSurvivors(d thunderAPI, c clusterAPI, cfg Configuration, lg *log.Entry, sg string, dms []drainMember, running map[string]bool) string {
+	n := 0
+	for _, dm := range dms {
+		if !running[dm.pod.Name] {
+			continue
+		}
+		n++
+		lg.Warn("Drained Pod '" + dm.pod.Name + "' survived the scale down, deleting it")
+		start := time.Now()
+		cctx, cancel := callCtx(context.Background(), cfg)
+		err := c.DeletePodCtx(cctx, dm.pod)
+		cancel()
+		observeCall("k8s", "DeletePod", start, err)
+		if err != nil && !k8sgo.IsNotFound(err) {
+			lg.Error("Deleting Pod '" + dm.pod.Name + "' failed, putting it back in service: " + err.Error())
+			clearDeletionCost(c, cfg, lg, []drainMember{dm})
+			enableMembers(d, cfg, lg, sg, []drainMember{dm})
+		}
+	}
+	if n == 0 {
+		return "ok"
+	}
+	return "ok, deleted " + strconv.Itoa(n) + " drained Pod(s) that survived the scale down"
+}
+
+//---------------------------------------------------------------------------------
+// clearDeletionCost()  --  Take the pod-deletion-cost back off Pods when a scale down is aborted.
+func clearDeletionCost(c clusterAPI, cfg Configuration, lg *log.Entry, dms []drainMember) {
+	for _, dm := range dms {
+		start := time.Now()
+		cctx, cancel := callCtx(context.Background(), cfg)
+		err := c.ClearPodDeletionCostCtx(cctx, dm.pod)
+		cancel()
+		observeCall("k8s", "ClearPodDeletionCost", start, err)
+		if err != nil && !k8sgo.IsNotFound(err) {
+			lg.Error("Clearing pod-deletion-cost on Pod '" + dm.pod.Name + "' failed: " + err.Error())
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------
+// enableMembers()  --  Put drained Members back into service after a failed scale down.
+func enableMembers(d thunderAPI, cfg Configuration, lg *log.Entry, sg string, dms []drainMember) {
+	for _, dm := range dms {
+		start := time.Now()
+		cctx, cancel := callCtx(context.Background(), cfg)
+		err := d.EnableMemberCtx(cctx, sg, dm.member)
+		cancel()
+		observeCall("axapi", "EnableMember", start, err)
+		if err != nil {
+			lg.Error("Re-enabling Member '" + dm.member.Name + "' failed: " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8sgo"
+
+	"a10/axapi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeDrain plays both the Thunder and the Cluster for the drain tests: Deployment 'cyan/webserver'
+// with Pods p1, p2... sent traffic by Members s1, s2... of Service Group 'ws-sg'. It keeps a list of
+// the calls that change anything.
+type fakeDrain struct {
+	mu        sync.Mutex
+	pods      []k8sgo.Pod
+	conns     map[string]uint64 // curr_conn of each Member
+	stuck     bool              // Connections do not finish once a Member is disabled
+	adjustErr error
+	port      axapi.PortStats
+	costed    map[string]bool
+	calls     []string
+}
+
+func newFakeDrain(conns ...uint64) *fakeDrain {
+	f := &fakeDrain{conns: make(map[string]uint64), costed: make(map[string]bool)}
+	for i, n := range conns {
+		f.addPod()
+		f.conns["s"+strconv.Itoa(i+1)] = n
+	}
+	return f
+}
+
+func (f *fakeDrain) addPod() {
+	id := strconv.Itoa(len(f.pods) + 1)
+	f.pods = append(f.pods, k8sgo.Pod{Name: "p" + id, Namespace: "cyan", IP: "10.0.0." + id, Phase: "Running", Ready: true})
+}
+
+func (f *fakeDrain) call(s string) {
+	f.calls = append(f.calls, s)
+}
+
+// called()  --  The calls made so far, as "disable s1, cost p1, adjust 2".
+func (f *fakeDrain) called() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return strings.Join(f.calls, ", ")
+}
+
+func (f *fakeDrain) GetVSPortStatsCtx(ctx context.Context, vs string, p string) (axapi.PortStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.port, nil
+}
+func (f *fakeDrain) GetServiceGroupsCtx(ctx context.Context) ([]axapi.SvcGrp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sg := axapi.SvcGrp{Name: "ws-sg"}
+	for i := range f.pods {
+		sg.Members = append(sg.Members, axapi.Member{Name: "s" + strconv.Itoa(i+1), Port: 80})
+	}
+	return []axapi.SvcGrp{sg}, nil
+}
+func (f *fakeDrain) GetSLBserversCtx(ctx context.Context) ([]axapi.Server, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ss []axapi.Server
+	for i, p := range f.pods {
+		ss = append(ss, axapi.Server{Name: "s" + strconv.Itoa(i+1), Host: p.IP})
+	}
+	return ss, nil
+}
+func (f *fakeDrain) GetMemberStatsCtx(ctx context.Context, sg string, m axapi.Member) (axapi.MemberStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return axapi.MemberStats{CurrConn: f.conns[m.Name]}, nil
+}
+func (f *fakeDrain) DisableMemberCtx(ctx context.Context, sg string, m axapi.Member) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("disable " + m.Name)
+	if !f.stuck {
+		f.conns[m.Name] = 0
+	}
+	return nil
+}
+func (f *fakeDrain) EnableMemberCtx(ctx context.Context, sg string, m axapi.Member) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("enable " + m.Name)
+	return nil
+}
+func (f *fakeDrain) GetHostnameCtx(ctx context.Context) (axapi.Device, error) {
+	return axapi.Device{}, nil
+}
+
+func (f *fakeDrain) deployment() k8sgo.Deployment {
+	n := 0
+	for _, p := range f.pods {
+		if !p.Deleting {
+			n++
+		}
+	}
+	return k8sgo.Deployment{Name: "webserver", Namespace: "cyan", CurrentReplicas: n}
+}
+func (f *fakeDrain) GetDeploymentStatusCtx(ctx context.Context, dep string, ns string) (k8sgo.Deployment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.deployment(), nil
+}
+
+// AdjustDeploymentCtx removes Pods that are not ready first, then those with a pod-deletion-cost, as
+// the ReplicaSet does.
+func (f *fakeDrain) AdjustDeploymentCtx(ctx context.Context, d k8sgo.Deployment, num int) (k8sgo.Deployment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("adjust " + strconv.Itoa(num))
+	if f.adjustErr != nil {
+		return d, f.adjustErr
+	}
+	for len(f.pods) < num {
+		f.addPod()
+	}
+	for f.deployment().CurrentReplicas > num {
+		drop := len(f.pods) - 1
+		for i := len(f.pods) - 1; i >= 0; i-- {
+			if !f.pods[i].Ready {
+				drop = i
+				break
+			}
+			if f.costed[f.pods[i].Name] {
+				drop = i
+			}
+		}
+		delete(f.costed, f.pods[drop].Name)
+		f.pods = append(f.pods[:drop], f.pods[drop+1:]...)
+	}
+	return f.deployment(), nil
+}
+func (f *fakeDrain) GetDeploymentPodsCtx(ctx context.Context, d k8sgo.Deployment) ([]k8sgo.Pod, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]k8sgo.Pod(nil), f.pods...), nil
+}
+func (f *fakeDrain) SetPodDeletionCostCtx(ctx context.Context, p k8sgo.Pod, cost int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("cost " + p.Name)
+	f.costed[p.Name] = true
+	return nil
+}
+func (f *fakeDrain) ClearPodDeletionCostCtx(ctx context.Context, p k8sgo.Pod) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("clear " + p.Name)
+	delete(f.costed, p.Name)
+	return nil
+}
+func (f *fakeDrain) DeletePodCtx(ctx context.Context, p k8sgo.Pod) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("delete " + p.Name)
+	return nil
+}
+func (f *fakeDrain) CreateEventCtx(ctx context.Context, e k8sgo.Event) error { return nil }
+func (f *fakeDrain) ListCustomObjectsCtx(ctx context.Context, r k8sgo.CustomResource, ns string) ([]k8sgo.CustomObject, error) {
+	return nil, nil
+}
+func (f *fakeDrain) PatchCustomObjectStatusCtx(ctx context.Context, r k8sgo.CustomResource, o k8sgo.CustomObject, status []byte) error {
+	return nil
+}
+
+// testAudit()  --  Send the audit records to a file for the rest of the test, and return its name.
+func testAudit(t *testing.T) string {
+	fn := filepath.Join(t.TempDir(), "audit.log")
+	old := audit
+	audit = &auditLog{}
+	if err := audit.open(AuditConfig{Output: fn}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { audit = old })
+	return fn
+}
+
+// fastDrain()  --  Poll the Members' connections every few milliseconds for the rest of the test.
+func fastDrain(t *testing.T) {
+	poll := drainPoll
+	drainPoll = 5 * time.Millisecond
+	t.Cleanup(func() { drainPoll = poll })
+}
+
+func TestDrainAndScale(t *testing.T) {
+	fastDrain(t)
+	fn := testAudit(t)
+	tests := []struct {
+		name   string
+		conns  []uint64 // Of each Pod
+		setup  func(f *fakeDrain)
+		dc     DrainConfig
+		rpl    int
+		calls  string
+		result string
+	}{
+		{"least busy Pods drained", []uint64{5, 0, 2, 9}, nil, DrainConfig{}, 2,
+			"disable s2, disable s3, cost p2, cost p3, adjust 2", "ok"},
+		{"Pods being deleted left out", []uint64{5, 3, 0, 2}, func(f *fakeDrain) { f.pods[2].Deleting = true }, DrainConfig{}, 2,
+			"disable s4, cost p4, adjust 2", "ok"},
+		{"Pods not ready left out, and deleted if they survive", []uint64{3, 0}, func(f *fakeDrain) {
+			f.pods[1].Ready = false // The ReplicaSet takes this one instead
+		}, DrainConfig{}, 1,
+			"disable s1, cost p1, adjust 1, delete p1", "ok, deleted 1 drained Pod(s) that survived the scale down"},
+		{"Service Group not found", []uint64{0, 3}, nil, DrainConfig{Service_Group: "other-sg"}, 1,
+			"adjust 1", "not drained: Service Group 'other-sg' not found on Thunder"},
+		{"too few Pods in the Service Group", []uint64{0, 3, 4}, func(f *fakeDrain) {
+			f.pods[0].Ready = false
+			f.pods[1].Phase = "Pending"
+		}, DrainConfig{}, 1,
+			"adjust 1", "not drained: only 1 of the Deployment's Pods are members of Service Group 'ws-sg'"},
+		{"timeout", []uint64{5, 7}, func(f *fakeDrain) { f.stuck = true }, DrainConfig{Timeout: 1}, 1,
+			"disable s1, cost p1, adjust 1", "drain timed out with 5 connections left; ok"},
+		{"Deployment patch fails", []uint64{0, 3}, func(f *fakeDrain) { f.adjustErr = errors.New("409 Conflict") }, DrainConfig{}, 1,
+			"disable s1, cost p1, adjust 1, clear p1, enable s1", "409 Conflict"},
+	}
+	lg := log.WithField("target", "web")
+	for _, tt := range tests {
+		f := newFakeDrain(tt.conns...)
+		if tt.setup != nil {
+			tt.setup(f)
+		}
+		dc := tt.dc
+		dc.Enabled = true
+		if dc.Service_Group == "" {
+			dc.Service_Group = "ws-sg"
+		}
+		tg := &Target{draining: drainWaiting}
+		y := f.deployment()
+		drainAndScale(context.Background(), f, f, Configuration{}, tg, "web", lg, dc, y, tt.rpl, "test", make(chan struct{}))
+		if got := f.called(); got != tt.calls {
+			t.Errorf("%s: calls = %q, want %q", tt.name, got, tt.calls)
+		}
+		if tg.isDraining() {
+			t.Errorf("%s: still draining after drainAndScale() returned", tt.name)
+		}
+		recs := readAudit(t, fn)
+		if rec := recs[len(recs)-1]; rec.Kind != "drain" || rec.Result != tt.result {
+			t.Errorf("%s: audit %s result = %q, want %q", tt.name, rec.Kind, rec.Result, tt.result)
+		}
+	}
+}
+
+func TestDrainCancelledOnSurge(t *testing.T) {
+	fastDrain(t)
+	fn := testAudit(t)
+	f := newFakeDrain(50, 50, 50)
+	f.stuck = true
+	tc := TargetConfig{Name: "web", SLB: "ws-vip", SLB_Port: "80+http", Deployment: "webserver", Namespace: "cyan",
+		Min_Pods: 1, Max_Pods: 10, Metrics: []MetricConfig{{Type: "curr_conn", Target: 100}},
+		Behavior: BehaviorConfig{Cooldown: 300}, Drain: DrainConfig{Enabled: true, Service_Group: "ws-sg", Timeout: 600}}
+	tg, err := newTarget(Configuration{}, tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	pass := func(conns uint64) {
+		f.mu.Lock()
+		f.port.CurrConn = conns
+		f.mu.Unlock()
+		scaleTarget(ctx, f, f, Configuration{}, tg, now)
+		now = now.Add(10 * time.Second)
+	}
+
+	// 150 connections need 2 of the 3 Pods: drain the least busy one
+	pass(150)
+	for i := 0; f.called() != "disable s1"; i++ {
+		if i > 1000 {
+			t.Fatalf("calls = %q, want the drain to disable s1", f.called())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Still needing 2 leaves the drain running
+	pass(150)
+	if !tg.isDraining() || f.called() != "disable s1" {
+		t.Fatalf("drain stopped on a pass that needs no more Pods (calls %q)", f.called())
+	}
+	// 400 connections need 4: put s1 back in service, then scale up, without waiting out the cooldown
+	pass(400)
+	if tg.isDraining() {
+		t.Error("still draining after the Replicas needed went up")
+	}
+	if got, want := f.called(), "disable s1, enable s1, adjust 4"; got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+	var results []string
+	for _, rec := range readAudit(t, fn) {
+		results = append(results, rec.Kind+": "+rec.Action+" "+rec.Result)
+	}
+	want := []string{"evaluation: scale_down draining", "evaluation: skipped still draining",
+		"drain: none cancelled, Replicas needed again", "evaluation: scale_up ok"}
+	if strings.Join(results, "; ") != strings.Join(want, "; ") {
+		t.Errorf("audit = %q, want %q", results, want)
+	}
+}
@@ -1,4 +1,4 @@
-module main
+module a10-autoscaler-k8s
 
 go 1.17
 
@@ -11,6 +11,7 @@ require (
 	github.com/sirupsen/logrus v1.8.1
 	github.com/tidwall/gjson v1.8.1
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 	k8sgo v0.0.0-00010101000000-000000000000
 )
 
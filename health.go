@@ -0,0 +1,93 @@
+package main
+
+//
+//  health.go
+//   Liveness & Readiness endpoints for Kubernetes probes.
+//    /healthz  -- OK while procLoop() keeps getting called on time.
+//    /readyz   -- OK while the last good Thunder call and the last good Kubernetes call were both
+//                 within 'ready_intervals' check intervals. A pass with no Targets to check still
+//                 makes a keepalive call to the Thunder.
+//
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultReadyIntervals = 3
+
+type healthState struct {
+	mu          sync.Mutex
+	interval    time.Duration // check_interval, 0 until the loop starts
+	intervals   int
+	lastTick    time.Time
+	lastThunder time.Time
+	lastK8s     time.Time
+}
+
+var health = &healthState{}
+
+//---------------------------------------------------------------------------------
+// tick()  --  Called at the start of every pass of procLoop().
+func (h *healthState) tick(now time.Time, cfg Configuration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastTick = now
+	h.interval = cfg.Interval * time.Second
+	h.intervals = cfg.HTTP.Ready_Intervals
+	if h.intervals == 0 {
+		h.intervals = defaultReadyIntervals
+	}
+}
+
+// called()  --  Record a good aXAPI ("axapi") or Kubernetes ("k8s") call.
+func (h *healthState) called(api string, err error) {
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch api {
+	case "axapi":
+		h.lastThunder = time.Now()
+	case "k8s":
+		h.lastK8s = time.Now()
+	}
+}
+
+// stale()  --  True if 't' is older than the allowed number of intervals.
+func (h *healthState) stale(t time.Time) bool {
+	return time.Since(t) > time.Duration(h.intervals)*h.interval
+}
+
+func (h *healthState) healthz(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.interval > 0 && h.stale(h.lastTick) {
+		http.Error(w, "processing loop last ran "+time.Since(h.lastTick).Truncate(time.Second).String()+" ago", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (h *healthState) readyz(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.interval == 0 {
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+		return
+	}
+	var msg string
+	if h.stale(h.lastThunder) {
+		msg = msg + "no good Thunder call in " + strconv.Itoa(h.intervals) + " intervals\n"
+	}
+	if h.stale(h.lastK8s) {
+		msg = msg + "no good Kubernetes call in " + strconv.Itoa(h.intervals) + " intervals\n"
+	}
+	if msg != "" {
+		http.Error(w, msg, http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,27 @@
+package main
+
+//
+//  http.go
+//   HTTP listener for the agent's /metrics, /healthz and /readyz endpoints.
+//
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//---------------------------------------------------------------------------------
+// startHTTP()  --  Start serving on 'listen' (ie. ":8080") in the background.
+func startHTTP(listen string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prom)
+	mux.HandleFunc("/healthz", health.healthz)
+	mux.HandleFunc("/readyz", health.readyz)
+
+	go func() {
+		log.Info("HTTP listener on " + listen)
+		if err := http.ListenAndServe(listen, mux); err != nil {
+			log.Error("HTTP listener failed: " + err.Error())
+		}
+	}()
+}
@@ -1,14 +1,20 @@
 package k8sgo
 
 import (
+	"context"
 	"crypto/tls"
 	b64 "encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	neturl "net/url"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/tidwall/gjson"
 )
@@ -20,38 +26,114 @@ import (
 type Cluster struct {
 	URL   string
 	Token string
+	Retry Retry
 }
 
+// Retry says how to retry calls that fail in a way that may clear up by itself: network
+// errors, and 429, 502, 503 & 504 responses. Only GETs are retried after a network error,
+// as we cannot tell whether the API Server acted on anything else. The zero value tries
+// each call just once.
+//-----------------------------------------------------------------------------
+type Retry struct {
+	Attempts int           // Tries per call, including the first
+	Backoff  time.Duration // Wait before the first retry; doubled for each retry after that
+	Max      time.Duration // Longest wait between tries
+}
+
+// Skip insecure SSL verify returns -- for now
+// One client for all calls, so connections to the API server get reused.
+var client = &http.Client{Transport: &http.Transport{
+	TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+}}
+
 // _restCall is the basic API callout function
 //-----------------------------------------------------------------------------
 func _restCall(c Cluster, url string, method string, payload *strings.Reader) ([]byte, error) {
-	var body []byte
+	return _restCallCtx(context.Background(), c, url, method, payload)
+}
 
-	u := "https://" + c.URL + url
-	if method == "" {
-		method = "GET"
+// _restCallCtx is _restCall with a Context; the call gives up when the Context is done.
+//-----------------------------------------------------------------------------
+func _restCallCtx(ctx context.Context, c Cluster, url string, method string, payload *strings.Reader) ([]byte, error) {
+	if method == "PATCH" {
+		return _restCallType(ctx, c, url, method, "application/strategic-merge-patch+json", payload)
 	}
+	return _restCallType(ctx, c, url, method, "application/json", payload)
+}
+
+// _restCallType is _restCall with the Content-Type picked by the caller. Custom Resources
+// do not support strategic merge patches, so they are sent as JSON merge patches.
+//-----------------------------------------------------------------------------
+func _restCallType(ctx context.Context, c Cluster, url string, method string, ctype string, payload *strings.Reader) ([]byte, error) {
 	if payload == nil {
 		payload = strings.NewReader("")
 	}
+	for try := 1; ; try++ {
+		payload.Seek(0, io.SeekStart)
+		body, err := _restCallOnce(ctx, c, url, method, ctype, payload)
+		if err == nil || try >= c.Retry.Attempts || !retryable(ctx, method, err) {
+			return body, err
+		}
+		if c.Retry.wait(ctx, try) != nil {
+			return body, err
+		}
+	}
+}
+
+// retryable()  --  True if a failed call is worth trying again.
+//---------------------------------------------------------------------------------------
+func retryable(ctx context.Context, method string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	for _, s := range []string{"429", "502", "503", "504"} {
+		if strings.HasPrefix(err.Error(), s) {
+			return true
+		}
+	}
+	var ue *neturl.Error
+	return (method == "" || method == "GET") && errors.As(err, &ue)
+}
 
-	// Skip insecure SSL verify returns -- for now
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// wait()  --  Sleep before retry number 'try', with jitter so callers do not retry in step.
+// Returns the Context's error if it is done first.
+//---------------------------------------------------------------------------------------
+func (r Retry) wait(ctx context.Context, try int) error {
+	w := r.Backoff
+	for i := 1; i < try && (r.Max == 0 || w < r.Max); i++ {
+		w *= 2
+	}
+	if r.Max > 0 && w > r.Max {
+		w = r.Max
+	}
+	w = w/2 + time.Duration(rand.Int63n(int64(w/2)+1))
+	t := time.NewTimer(w)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// _restCallOnce makes a single try of the call.
+//-----------------------------------------------------------------------------
+func _restCallOnce(ctx context.Context, c Cluster, url string, method string, ctype string, payload *strings.Reader) ([]byte, error) {
+	var body []byte
+
+	u := "https://" + c.URL + url
+	if method == "" {
+		method = "GET"
 	}
-	client := &http.Client{Transport: tr}
+
 	// set the HTTPS request
-	req, err := http.NewRequest(method, u, payload)
+	req, err := http.NewRequestWithContext(ctx, method, u, payload)
 	if err != nil {
 		return []byte{}, err
 	}
 
-	if strings.HasSuffix(url, "/scale") {
-		req.Header.Add("Content-Type", "application/strategic-merge-patch+json")
-	} else {
-		req.Header.Add("Content-Type", "application/json")
-	}
-	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Content-Type", ctype)
 	req.Header.Add("Authorization", "Bearer "+c.Token)
 
 	res, err := client.Do(req)
@@ -90,8 +172,13 @@ func (c Cluster) SetToken(token string) Cluster {
 // getAllPods()  --  Return names of all pods on the Cluster
 //---------------------------------------------------------------------------------------
 func (c Cluster) GetAllPods() ([]string, error) {
+	return c.GetAllPodsCtx(context.Background())
+}
+
+// GetAllPodsCtx is GetAllPods() with a Context, for a deadline or cancelling the call.
+func (c Cluster) GetAllPodsCtx(ctx context.Context) ([]string, error) {
 	url := "/api/v1/pods"
-	body, err := _restCall(c, url, "GET", nil)
+	body, err := _restCallCtx(ctx, c, url, "GET", nil)
 	if err != nil {
 		return []string{}, err
 	}
@@ -105,8 +192,13 @@ func (c Cluster) GetAllPods() ([]string, error) {
 // GetDeploymentNames()  -- Return all Deployment Names
 //---------------------------------------------------------------------------------------
 func (c Cluster) GetDeploymentNames() ([]string, error) {
+	return c.GetDeploymentNamesCtx(context.Background())
+}
+
+// GetDeploymentNamesCtx is GetDeploymentNames() with a Context, for a deadline or cancelling the call.
+func (c Cluster) GetDeploymentNamesCtx(ctx context.Context) ([]string, error) {
 	url := "/apis/apps/v1/deployments"
-	body, err := _restCall(c, url, "GET", nil)
+	body, err := _restCallCtx(ctx, c, url, "GET", nil)
 	if err != nil {
 		return []string{}, err
 	}
@@ -127,26 +219,46 @@ func (c Cluster) GetDeploymentNames() ([]string, error) {
 type Deployment struct {
 	Name            string
 	Namespace       string
+	UID             string
 	MinReplicas     int
 	CurrentReplicas int
+	Selector        string // Label Selector for the Deployment's Pods, ie. "app=web,tier=front"
 }
 
 func (c Cluster) GetDeploymentStatus(dep string, ns string) (Deployment, error) {
+	return c.GetDeploymentStatusCtx(context.Background(), dep, ns)
+}
+
+// GetDeploymentStatusCtx is GetDeploymentStatus() with a Context, for a deadline or cancelling the call.
+func (c Cluster) GetDeploymentStatusCtx(ctx context.Context, dep string, ns string) (Deployment, error) {
 	var d Deployment
 	url := "/apis/apps/v1/namespaces/" + ns + "/deployments/" + dep
-	body, err := _restCall(c, url, "GET", nil)
+	body, err := _restCallCtx(ctx, c, url, "GET", nil)
 	if err != nil {
 		return d, err
 	}
 	d.Name = gjson.GetBytes(body, "metadata.name").Str
 	d.Namespace = gjson.GetBytes(body, "metadata.namespace").Str
+	d.UID = gjson.GetBytes(body, "metadata.uid").Str
 	d.CurrentReplicas = int(gjson.GetBytes(body, "spec.replicas").Int())
+	var sel []string
+	gjson.GetBytes(body, "spec.selector.matchLabels").ForEach(func(k, v gjson.Result) bool {
+		sel = append(sel, k.String()+"="+v.String())
+		return true
+	})
+	sort.Strings(sel)
+	d.Selector = strings.Join(sel, ",")
 	return d, nil
 }
 
 // AdjustDeployment()
 //---------------------------------------------------------------------------------------
 func (c Cluster) AdjustDeployment(d Deployment, num int) (Deployment, error) {
+	return c.AdjustDeploymentCtx(context.Background(), d, num)
+}
+
+// AdjustDeploymentCtx is AdjustDeployment() with a Context, for a deadline or cancelling the call.
+func (c Cluster) AdjustDeploymentCtx(ctx context.Context, d Deployment, num int) (Deployment, error) {
 	//
 	//  'num' is the number of Replicas that should be running after the adjustment.
 	var n int
@@ -168,7 +280,7 @@ func (c Cluster) AdjustDeployment(d Deployment, num int) (Deployment, error) {
 	}
 	pl := strings.NewReader("{\n\"spec\":{\n\"replicas\": " + fmt.Sprint(n) + "\n}\n}")
 	url := "/apis/apps/v1/namespaces/" + d.Namespace + "/deployments/" + d.Name + "/scale"
-	body, err := _restCall(c, url, "PATCH", pl)
+	body, err := _restCallCtx(ctx, c, url, "PATCH", pl)
 	//fmt.Println(string(body))
 	if err != nil {
 		return d, err
@@ -184,6 +296,314 @@ func (c Cluster) AdjustDeployment(d Deployment, num int) (Deployment, error) {
 	return d, nil
 }
 
+// GetDeploymentPods()
+//---------------------------------------------------------------------------------------
+type Pod struct {
+	Name      string
+	Namespace string
+	IP        string
+	Phase     string
+	Node      string
+	Deleting  bool // Pod has a deletionTimestamp
+	Ready     bool // Pod's Ready condition is True
+}
+
+func (c Cluster) GetDeploymentPods(d Deployment) ([]Pod, error) {
+	return c.GetDeploymentPodsCtx(context.Background(), d)
+}
+
+// GetDeploymentPodsCtx is GetDeploymentPods() with a Context, for a deadline or cancelling the call.
+func (c Cluster) GetDeploymentPodsCtx(ctx context.Context, d Deployment) ([]Pod, error) {
+	var pods []Pod
+	if d.Selector == "" {
+		return pods, errors.New("Deployment '" + d.Name + "' has no Label Selector")
+	}
+	url := "/api/v1/namespaces/" + d.Namespace + "/pods?labelSelector=" + neturl.QueryEscape(d.Selector)
+	body, err := _restCallCtx(ctx, c, url, "GET", nil)
+	if err != nil {
+		return pods, err
+	}
+	for _, v := range gjson.GetBytes(body, "items").Array() {
+		var p Pod
+		p.Name = v.Get("metadata.name").Str
+		p.Namespace = v.Get("metadata.namespace").Str
+		p.IP = v.Get("status.podIP").Str
+		p.Phase = v.Get("status.phase").Str
+		p.Node = v.Get("spec.nodeName").Str
+		p.Deleting = v.Get("metadata.deletionTimestamp").Exists()
+		p.Ready = v.Get(`status.conditions.#(type=="Ready").status`).Str == "True"
+		pods = append(pods, p)
+	}
+	return pods, nil
+}
+
+// SetPodDeletionCost()
+//---------------------------------------------------------------------------------------
+// The ReplicaSet controller removes Pods with the lowest cost first when a Deployment is
+// scaled down, so setting a negative cost picks which Pods go away.
+func (c Cluster) SetPodDeletionCost(p Pod, cost int) error {
+	return c.SetPodDeletionCostCtx(context.Background(), p, cost)
+}
+
+// SetPodDeletionCostCtx is SetPodDeletionCost() with a Context, for a deadline or cancelling the call.
+func (c Cluster) SetPodDeletionCostCtx(ctx context.Context, p Pod, cost int) error {
+	pl := strings.NewReader("{\n\"metadata\":{\n\"annotations\":{\n\"controller.kubernetes.io/pod-deletion-cost\": \"" + fmt.Sprint(cost) + "\"\n}\n}\n}")
+	url := "/api/v1/namespaces/" + p.Namespace + "/pods/" + p.Name
+	_, err := _restCallCtx(ctx, c, url, "PATCH", pl)
+	return err
+}
+
+// ClearPodDeletionCost()
+//---------------------------------------------------------------------------------------
+// Take the pod-deletion-cost annotation back off a Pod.
+func (c Cluster) ClearPodDeletionCost(p Pod) error {
+	return c.ClearPodDeletionCostCtx(context.Background(), p)
+}
+
+// ClearPodDeletionCostCtx is ClearPodDeletionCost() with a Context, for a deadline or cancelling the call.
+func (c Cluster) ClearPodDeletionCostCtx(ctx context.Context, p Pod) error {
+	pl := strings.NewReader("{\n\"metadata\":{\n\"annotations\":{\n\"controller.kubernetes.io/pod-deletion-cost\": null\n}\n}\n}")
+	url := "/api/v1/namespaces/" + p.Namespace + "/pods/" + p.Name
+	_, err := _restCallCtx(ctx, c, url, "PATCH", pl)
+	return err
+}
+
+// DeletePod()
+//---------------------------------------------------------------------------------------
+func (c Cluster) DeletePod(p Pod) error {
+	return c.DeletePodCtx(context.Background(), p)
+}
+
+// DeletePodCtx is DeletePod() with a Context, for a deadline or cancelling the call.
+func (c Cluster) DeletePodCtx(ctx context.Context, p Pod) error {
+	url := "/api/v1/namespaces/" + p.Namespace + "/pods/" + p.Name
+	_, err := _restCallCtx(ctx, c, url, "DELETE", nil)
+	return err
+}
+
+// IsNotFound()  --  True if the error from a call is the API Server saying the object does not exist.
+//---------------------------------------------------------------------------------------
+func IsNotFound(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "404")
+}
+
+// IsConflict()  --  True if the object was changed by someone else since it was read.
+//---------------------------------------------------------------------------------------
+func IsConflict(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "409")
+}
+
+// GetLease()
+//---------------------------------------------------------------------------------------
+// Leases (coordination.k8s.io/v1) are used for Leader Election.
+type Lease struct {
+	Name            string
+	Namespace       string
+	Holder          string
+	DurationSeconds int
+	AcquireTime     time.Time
+	RenewTime       time.Time
+	Transitions     int
+	ResourceVersion string
+}
+
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+func leaseFromJSON(body []byte) Lease {
+	var l Lease
+	l.Name = gjson.GetBytes(body, "metadata.name").Str
+	l.Namespace = gjson.GetBytes(body, "metadata.namespace").Str
+	l.ResourceVersion = gjson.GetBytes(body, "metadata.resourceVersion").Str
+	l.Holder = gjson.GetBytes(body, "spec.holderIdentity").Str
+	l.DurationSeconds = int(gjson.GetBytes(body, "spec.leaseDurationSeconds").Int())
+	l.AcquireTime, _ = time.Parse(microTime, gjson.GetBytes(body, "spec.acquireTime").Str)
+	l.RenewTime, _ = time.Parse(microTime, gjson.GetBytes(body, "spec.renewTime").Str)
+	l.Transitions = int(gjson.GetBytes(body, "spec.leaseTransitions").Int())
+	return l
+}
+
+func leaseToJSON(l Lease) string {
+	b, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "coordination.k8s.io/v1",
+		"kind":       "Lease",
+		"metadata": map[string]interface{}{
+			"name":            l.Name,
+			"namespace":       l.Namespace,
+			"resourceVersion": l.ResourceVersion,
+		},
+		"spec": map[string]interface{}{
+			"holderIdentity":       l.Holder,
+			"leaseDurationSeconds": l.DurationSeconds,
+			"acquireTime":          l.AcquireTime.UTC().Format(microTime),
+			"renewTime":            l.RenewTime.UTC().Format(microTime),
+			"leaseTransitions":     l.Transitions,
+		},
+	})
+	return string(b)
+}
+
+func (c Cluster) GetLease(name string, ns string) (Lease, error) {
+	return c.GetLeaseCtx(context.Background(), name, ns)
+}
+
+// GetLeaseCtx is GetLease() with a Context, for a deadline or cancelling the call.
+func (c Cluster) GetLeaseCtx(ctx context.Context, name string, ns string) (Lease, error) {
+	url := "/apis/coordination.k8s.io/v1/namespaces/" + ns + "/leases/" + name
+	body, err := _restCallCtx(ctx, c, url, "GET", nil)
+	if err != nil {
+		return Lease{}, err
+	}
+	return leaseFromJSON(body), nil
+}
+
+// CreateLease()
+//---------------------------------------------------------------------------------------
+func (c Cluster) CreateLease(l Lease) (Lease, error) {
+	return c.CreateLeaseCtx(context.Background(), l)
+}
+
+// CreateLeaseCtx is CreateLease() with a Context, for a deadline or cancelling the call.
+func (c Cluster) CreateLeaseCtx(ctx context.Context, l Lease) (Lease, error) {
+	l.ResourceVersion = ""
+	url := "/apis/coordination.k8s.io/v1/namespaces/" + l.Namespace + "/leases"
+	body, err := _restCallCtx(ctx, c, url, "POST", strings.NewReader(leaseToJSON(l)))
+	if err != nil {
+		return l, err
+	}
+	return leaseFromJSON(body), nil
+}
+
+// UpdateLease()
+//---------------------------------------------------------------------------------------
+// The ResourceVersion from GetLease() must be set; if the Lease was changed since then,
+// the update fails with a Conflict (see IsConflict()).
+func (c Cluster) UpdateLease(l Lease) (Lease, error) {
+	return c.UpdateLeaseCtx(context.Background(), l)
+}
+
+// UpdateLeaseCtx is UpdateLease() with a Context, for a deadline or cancelling the call.
+func (c Cluster) UpdateLeaseCtx(ctx context.Context, l Lease) (Lease, error) {
+	url := "/apis/coordination.k8s.io/v1/namespaces/" + l.Namespace + "/leases/" + l.Name
+	body, err := _restCallCtx(ctx, c, url, "PUT", strings.NewReader(leaseToJSON(l)))
+	if err != nil {
+		return l, err
+	}
+	return leaseFromJSON(body), nil
+}
+
+// CreateEvent()
+//---------------------------------------------------------------------------------------
+// Events show up in 'kubectl describe' for the object they are about. The UID of the object
+// should be set, as kubectl only lists Events whose involvedObject matches it.
+type Event struct {
+	Kind       string // Of the object, ie. "Deployment"
+	APIVersion string // Of the object, ie. "apps/v1"
+	Name       string
+	Namespace  string
+	UID        string
+	Type       string // "Normal" or "Warning"
+	Reason     string // ie. "ScaledUp"
+	Message    string
+	Component  string // Who is reporting the Event
+}
+
+func (c Cluster) CreateEvent(e Event) error {
+	return c.CreateEventCtx(context.Background(), e)
+}
+
+// CreateEventCtx is CreateEvent() with a Context, for a deadline or cancelling the call.
+func (c Cluster) CreateEventCtx(ctx context.Context, e Event) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	b, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata": map[string]interface{}{
+			"generateName": e.Name + ".",
+			"namespace":    e.Namespace,
+		},
+		"involvedObject": map[string]interface{}{
+			"kind":       e.Kind,
+			"apiVersion": e.APIVersion,
+			"name":       e.Name,
+			"namespace":  e.Namespace,
+			"uid":        e.UID,
+		},
+		"type":               e.Type,
+		"reason":             e.Reason,
+		"message":            e.Message,
+		"source":             map[string]interface{}{"component": e.Component},
+		"reportingComponent": e.Component,
+		"firstTimestamp":     now,
+		"lastTimestamp":      now,
+		"count":              1,
+	})
+	url := "/api/v1/namespaces/" + e.Namespace + "/events"
+	_, err := _restCallCtx(ctx, c, url, "POST", strings.NewReader(string(b)))
+	return err
+}
+
+// ListCustomObjects()
+//---------------------------------------------------------------------------------------
+// Objects of a Custom Resource Definition, with the spec & status left as raw JSON for the
+// caller to decode.
+type CustomResource struct {
+	Group   string // ie. "autoscaling.a10networks.com"
+	Version string // ie. "v1alpha1"
+	Plural  string // ie. "a10autoscalers"
+}
+
+type CustomObject struct {
+	Name       string
+	Namespace  string
+	UID        string
+	Generation int64
+	Spec       []byte
+	Status     []byte
+}
+
+func (c Cluster) ListCustomObjects(r CustomResource, ns string) ([]CustomObject, error) {
+	return c.ListCustomObjectsCtx(context.Background(), r, ns)
+}
+
+// ListCustomObjectsCtx is ListCustomObjects() with a Context, for a deadline or cancelling the call.
+func (c Cluster) ListCustomObjectsCtx(ctx context.Context, r CustomResource, ns string) ([]CustomObject, error) {
+	var objs []CustomObject
+	url := "/apis/" + r.Group + "/" + r.Version + "/" + r.Plural
+	if ns != "" {
+		url = "/apis/" + r.Group + "/" + r.Version + "/namespaces/" + ns + "/" + r.Plural
+	}
+	body, err := _restCallCtx(ctx, c, url, "GET", nil)
+	if err != nil {
+		return objs, err
+	}
+	for _, v := range gjson.GetBytes(body, "items").Array() {
+		var o CustomObject
+		o.Name = v.Get("metadata.name").Str
+		o.Namespace = v.Get("metadata.namespace").Str
+		o.UID = v.Get("metadata.uid").Str
+		o.Generation = v.Get("metadata.generation").Int()
+		o.Spec = []byte(v.Get("spec").Raw)
+		o.Status = []byte(v.Get("status").Raw)
+		objs = append(objs, o)
+	}
+	return objs, nil
+}
+
+// PatchCustomObjectStatus()
+//---------------------------------------------------------------------------------------
+// Merge 'status' (JSON) into the status of the object. The CRD must have the status subresource.
+func (c Cluster) PatchCustomObjectStatus(r CustomResource, o CustomObject, status []byte) error {
+	return c.PatchCustomObjectStatusCtx(context.Background(), r, o, status)
+}
+
+// PatchCustomObjectStatusCtx is PatchCustomObjectStatus() with a Context, for a deadline or cancelling the call.
+func (c Cluster) PatchCustomObjectStatusCtx(ctx context.Context, r CustomResource, o CustomObject, status []byte) error {
+	pl := strings.NewReader("{\"status\":" + string(status) + "}")
+	url := "/apis/" + r.Group + "/" + r.Version + "/namespaces/" + o.Namespace + "/" + r.Plural + "/" + o.Name + "/status"
+	_, err := _restCallType(ctx, c, url, "PATCH", "application/merge-patch+json", pl)
+	return err
+}
+
 // GetSecret()
 //---------------------------------------------------------------------------------------
 type Secret struct {
@@ -192,10 +612,15 @@ type Secret struct {
 }
 
 func (c Cluster) GetSecret(name string, ns string) (Secret, error) {
+	return c.GetSecretCtx(context.Background(), name, ns)
+}
+
+// GetSecretCtx is GetSecret() with a Context, for a deadline or cancelling the call.
+func (c Cluster) GetSecretCtx(ctx context.Context, name string, ns string) (Secret, error) {
 	var s Secret
 
 	url := "/api/v1/namespaces/" + ns + "/secrets/" + name
-	body, err := _restCall(c, url, "GET", nil)
+	body, err := _restCallCtx(ctx, c, url, "GET", nil)
 	if err != nil {
 		return s, err
 	}
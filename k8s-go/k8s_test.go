@@ -0,0 +1,101 @@
+package k8sgo
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCluster()  --  A Cluster pointed at a TLS test server that answers each try with the
+// next of 'codes' (the last one repeats); a code of 0 drops the connection instead.
+func testCluster(t *testing.T, codes []int, tries *int, bodies *[]string) Cluster {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		*bodies = append(*bodies, string(b))
+		code := codes[len(codes)-1]
+		if *tries < len(codes) {
+			code = codes[*tries]
+		}
+		*tries++
+		if code == 0 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(code)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(srv.Close)
+	return Cluster{URL: srv.Listener.Addr().String(), Token: "t",
+		Retry: Retry{Attempts: 3, Backoff: time.Millisecond, Max: 2 * time.Millisecond}}
+}
+
+func TestRestCallRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		codes  []int
+		tries  int
+		ok     bool
+	}{
+		{"ok first time", "GET", []int{200}, 1, true},
+		{"503 then ok", "GET", []int{503, 503, 200}, 3, true},
+		{"429 on a PUT", "PUT", []int{429, 200}, 2, true},
+		{"502 and 504", "PATCH", []int{502, 504, 200}, 3, true},
+		{"gives up after attempts", "GET", []int{503}, 3, false},
+		{"404 not retried", "GET", []int{404}, 1, false},
+		{"500 not retried", "GET", []int{500}, 1, false},
+		{"network error on a GET", "GET", []int{0, 200}, 2, true},
+		{"network error on a POST", "POST", []int{0, 200}, 1, false},
+	}
+	for _, tt := range tests {
+		tries := 0
+		var bodies []string
+		c := testCluster(t, tt.codes, &tries, &bodies)
+		body, err := _restCallCtx(context.Background(), c, "/x", tt.method, strings.NewReader(`{"a":1}`))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok %v", tt.name, err, tt.ok)
+		}
+		if tt.ok && string(body) != `{"ok":true}` {
+			t.Errorf("%s: body = %q", tt.name, body)
+		}
+		if tries != tt.tries {
+			t.Errorf("%s: %d tries, want %d", tt.name, tries, tt.tries)
+		}
+		for i, b := range bodies {
+			if b != `{"a":1}` {
+				t.Errorf("%s: try %d sent %q, want the whole payload", tt.name, i+1, b)
+			}
+		}
+	}
+}
+
+func TestRestCallZeroRetry(t *testing.T) {
+	tries := 0
+	var bodies []string
+	c := testCluster(t, []int{503, 200}, &tries, &bodies)
+	c.Retry = Retry{}
+	if _, err := _restCallCtx(context.Background(), c, "/x", "GET", nil); err == nil || tries != 1 {
+		t.Errorf("zero Retry: err = %v after %d tries, want an error after 1", err, tries)
+	}
+}
+
+func TestRestCallContextDone(t *testing.T) {
+	tries := 0
+	var bodies []string
+	c := testCluster(t, []int{503}, &tries, &bodies)
+	c.Retry = Retry{Attempts: 5, Backoff: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := _restCallCtx(ctx, c, "/x", "GET", nil); err == nil {
+		t.Error("call succeeded, want the 503")
+	}
+	if d := time.Since(start); d > 5*time.Second || tries != 1 {
+		t.Errorf("gave up after %v and %d tries, want soon after the Context is done", d, tries)
+	}
+}
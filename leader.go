@@ -0,0 +1,171 @@
+package main
+
+//
+//  leader.go
+//   Leader Election, so more than one copy of the agent can be run for High Availability. The copies
+//   race for a coordination.k8s.io Lease; only the holder (the leader) scales Deployments. The others
+//   stay logged in to the Thunder and keep checking the Lease, ready to take over if the leader stops
+//   renewing it.
+//
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"k8sgo"
+
+	"a10/axapi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LeaderConfig is the 'leader_election' section of the config file. Times are in seconds.
+type LeaderConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Lease_Name     string        `yaml:"lease_name"`
+	Namespace      string        `yaml:"namespace"`
+	Identity       string        `yaml:"identity"`       // Defaults to the hostname (Pod name)
+	Lease_Duration time.Duration `yaml:"lease_duration"` // How long a Lease is good for without renewal
+	Retry_Period   time.Duration `yaml:"retry_period"`   // How often to renew / try to acquire
+}
+
+const (
+	defaultLeaseName     = "a10-autoscaler-k8s"
+	defaultLeaseDuration = 15
+	defaultRetryPeriod   = 5
+)
+
+var leading int32 // Set while this agent holds the Lease; use atomic
+
+//---------------------------------------------------------------------------------
+// isLeader()  --  True if this agent should be scaling Deployments.
+func isLeader(cfg Configuration) bool {
+	return !cfg.Leader.Enabled || atomic.LoadInt32(&leading) == 1
+}
+
+//---------------------------------------------------------------------------------
+// runLeaderElection()  --  Try to acquire, then keep renewing, the Lease. Runs forever.
+func runLeaderElection(c k8sgo.Cluster, cfg Configuration) {
+	lc := cfg.Leader
+	if lc.Lease_Name == "" {
+		lc.Lease_Name = defaultLeaseName
+	}
+	if lc.Namespace == "" {
+		lc.Namespace = os.Getenv("POD_NAMESPACE")
+		if lc.Namespace == "" {
+			lc.Namespace = "default"
+		}
+	}
+	if lc.Identity == "" {
+		lc.Identity, _ = os.Hostname()
+	}
+	if lc.Lease_Duration == 0 {
+		lc.Lease_Duration = defaultLeaseDuration
+	}
+	if lc.Retry_Period == 0 {
+		lc.Retry_Period = defaultRetryPeriod
+	}
+	dur := lc.Lease_Duration * time.Second
+	log.Info("Leader Election using Lease '" + lc.Namespace + "/" + lc.Lease_Name + "' as '" + lc.Identity + "'")
+
+	var lastRenew time.Time
+	for {
+		ok, err := tryLease(c, cfg, lc)
+		now := time.Now()
+		switch {
+		case ok:
+			lastRenew = now
+			if atomic.SwapInt32(&leading, 1) == 0 {
+				log.Info("Became leader, scaling is active")
+			}
+		case err != nil && now.Sub(lastRenew) < dur*2/3:
+			// Could not reach the API Server; keep leading until the Lease is close to running out.
+			log.Warn("Lease renewal failed: " + err.Error())
+		default:
+			if err != nil {
+				log.Warn("Lease renewal failed: " + err.Error())
+			}
+			if atomic.SwapInt32(&leading, 0) == 1 {
+				log.Warn("Lost leadership, scaling is on standby")
+			}
+		}
+		time.Sleep(lc.Retry_Period * time.Second)
+	}
+}
+
+// tryLease()  --  Acquire or renew the Lease. Returns true if we hold it.
+func tryLease(c k8sgo.Cluster, cfg Configuration, lc LeaderConfig) (bool, error) {
+	now := time.Now()
+	start := now
+	cctx, cancel := callCtx(context.Background(), cfg)
+	l, err := c.GetLeaseCtx(cctx, lc.Lease_Name, lc.Namespace)
+	cancel()
+	observeCall("k8s", "GetLease", start, err)
+	if k8sgo.IsNotFound(err) {
+		l = k8sgo.Lease{
+			Name:            lc.Lease_Name,
+			Namespace:       lc.Namespace,
+			Holder:          lc.Identity,
+			DurationSeconds: int(lc.Lease_Duration),
+			AcquireTime:     now,
+			RenewTime:       now,
+		}
+		start = time.Now()
+		cctx, cancel = callCtx(context.Background(), cfg)
+		_, err = c.CreateLeaseCtx(cctx, l)
+		cancel()
+		observeCall("k8s", "CreateLease", start, err)
+		if k8sgo.IsConflict(err) {
+			return false, nil // Someone else got there first
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if l.Holder != lc.Identity {
+		expires := l.RenewTime.Add(time.Duration(l.DurationSeconds) * time.Second)
+		if l.Holder != "" && now.Before(expires) {
+			return false, nil // Someone else is leading
+		}
+		log.Info("Lease held by '" + l.Holder + "' has expired, taking over (transition " + strconv.Itoa(l.Transitions+1) + ")")
+		l.Holder = lc.Identity
+		l.AcquireTime = now
+		l.Transitions++
+	}
+	l.DurationSeconds = int(lc.Lease_Duration)
+	l.RenewTime = now
+	start = time.Now()
+	cctx, cancel = callCtx(context.Background(), cfg)
+	_, err = c.UpdateLeaseCtx(cctx, l)
+	cancel()
+	observeCall("k8s", "UpdateLease", start, err)
+	if k8sgo.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//---------------------------------------------------------------------------------
+// standby()  --  Pass of the processing loop while another agent is leading. Just keeps the
+// Thunder session from timing out, so we are ready to take over.
+func standby(ctx context.Context, d axapi.Device, cfg Configuration) {
+	health.tick(time.Now(), cfg)
+	keepalive(ctx, d, cfg)
+}
+
+// keepalive()  --  Make a cheap Thunder call, for passes that make no other; keeps the session alive,
+// and /readyz up to date.
+func keepalive(ctx context.Context, d thunderAPI, cfg Configuration) {
+	start := time.Now()
+	cctx, cancel := callCtx(ctx, cfg)
+	_, err := d.GetHostnameCtx(cctx)
+	cancel()
+	observeCall("axapi", "GetHostname", start, err)
+	if err != nil {
+		log.Error("Thunder keepalive failed: " + err.Error())
+	}
+}
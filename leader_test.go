@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8sgo"
+)
+
+// fakeK8s is a Kubernetes API Server that answers from a table of replies keyed by
+// "METHOD /path", and keeps the calls made to it. Anything not in the table gets a 404.
+type fakeK8s struct {
+	mu    sync.Mutex
+	reply map[string]fakeReply
+	calls []fakeCall
+}
+
+type fakeReply struct {
+	code int
+	body string
+}
+
+type fakeCall struct {
+	method, path, body string
+}
+
+func newFakeK8s(t *testing.T, reply map[string]fakeReply) (*fakeK8s, k8sgo.Cluster) {
+	f := &fakeK8s{reply: reply}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.calls = append(f.calls, fakeCall{r.Method, r.URL.Path, string(b)})
+		rp, ok := f.reply[r.Method+" "+r.URL.Path]
+		if !ok {
+			rp = fakeReply{404, `{"kind":"Status","code":404}`}
+		}
+		w.WriteHeader(rp.code)
+		w.Write([]byte(rp.body))
+	}))
+	t.Cleanup(srv.Close)
+	return f, k8sgo.Cluster{URL: srv.Listener.Addr().String(), Token: "t"}
+}
+
+// called()  --  The calls made with this method, in order.
+func (f *fakeK8s) called(method string) []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cs []fakeCall
+	for _, c := range f.calls {
+		if c.method == method {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+const leasePath = "/apis/coordination.k8s.io/v1/namespaces/ns/leases/lock"
+
+func leaseJSON(holder string, renew time.Time, transitions int) string {
+	return fmt.Sprintf(`{"metadata":{"name":"lock","namespace":"ns","resourceVersion":"7"},`+
+		`"spec":{"holderIdentity":"%s","leaseDurationSeconds":15,"acquireTime":"%s","renewTime":"%s","leaseTransitions":%d}}`,
+		holder, renew.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), renew.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), transitions)
+}
+
+func TestTryLease(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		reply  map[string]fakeReply
+		ok     bool
+		err    bool
+		holder string // Written by the create or update, if any
+		trans  int
+	}{
+		{"no Lease yet", map[string]fakeReply{
+			"POST /apis/coordination.k8s.io/v1/namespaces/ns/leases": {201, "{}"},
+		}, true, false, "me", 0},
+		{"create loses the race", map[string]fakeReply{
+			"POST /apis/coordination.k8s.io/v1/namespaces/ns/leases": {409, "{}"},
+		}, false, false, "me", 0},
+		{"held by another", map[string]fakeReply{
+			"GET " + leasePath: {200, leaseJSON("other", now.Add(-5*time.Second), 1)},
+		}, false, false, "", 0},
+		{"held by another and expired", map[string]fakeReply{
+			"GET " + leasePath: {200, leaseJSON("other", now.Add(-time.Minute), 1)},
+			"PUT " + leasePath: {200, "{}"},
+		}, true, false, "me", 2},
+		{"released", map[string]fakeReply{
+			"GET " + leasePath: {200, leaseJSON("", now.Add(-5*time.Second), 1)},
+			"PUT " + leasePath: {200, "{}"},
+		}, true, false, "me", 2},
+		{"renew our own", map[string]fakeReply{
+			"GET " + leasePath: {200, leaseJSON("me", now.Add(-5*time.Second), 3)},
+			"PUT " + leasePath: {200, "{}"},
+		}, true, false, "me", 3},
+		{"renew conflicts", map[string]fakeReply{
+			"GET " + leasePath: {200, leaseJSON("me", now.Add(-5*time.Second), 3)},
+			"PUT " + leasePath: {409, "{}"},
+		}, false, false, "me", 3},
+		{"API Server error", map[string]fakeReply{
+			"GET " + leasePath: {500, "{}"},
+		}, false, true, "", 0},
+	}
+	lc := LeaderConfig{Enabled: true, Lease_Name: "lock", Namespace: "ns", Identity: "me", Lease_Duration: 15}
+	for _, tt := range tests {
+		f, c := newFakeK8s(t, tt.reply)
+		ok, err := tryLease(c, Configuration{}, lc)
+		if ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("%s: tryLease() = %v, %v; want %v, error %v", tt.name, ok, err, tt.ok, tt.err)
+		}
+		writes := append(f.called("POST"), f.called("PUT")...)
+		if tt.holder == "" {
+			if len(writes) > 0 {
+				t.Errorf("%s: wrote the Lease: %+v", tt.name, writes)
+			}
+			continue
+		}
+		if len(writes) != 1 {
+			t.Errorf("%s: %d Lease writes, want 1", tt.name, len(writes))
+			continue
+		}
+		want := fmt.Sprintf(`"holderIdentity":"%s"`, tt.holder)
+		if !strings.Contains(writes[0].body, want) || !strings.Contains(writes[0].body, fmt.Sprintf(`"leaseTransitions":%d`, tt.trans)) {
+			t.Errorf("%s: wrote %s, want holder %s and %d transitions", tt.name, writes[0].body, tt.holder, tt.trans)
+		}
+	}
+	breakers["k8s"].called(nil) // Leave the breaker closed for other tests
+}
+
+func TestIsLeader(t *testing.T) {
+	defer func(l int32) { leading = l }(leading)
+	leading = 0
+	if !isLeader(Configuration{}) {
+		t.Error("isLeader() with Leader Election off = false, want true")
+	}
+	cfg := Configuration{Leader: LeaderConfig{Enabled: true}}
+	if isLeader(cfg) {
+		t.Error("isLeader() before getting the Lease = true")
+	}
+	leading = 1
+	if !isLeader(cfg) {
+		t.Error("isLeader() holding the Lease = false")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+//
+//  logging.go
+//   Log format & level. 'log_format: json' writes one JSON object per line for log pipelines such as
+//   Loki; the default 'text' is the human readable format with timestamps. The 'debug' setting maps
+//   onto the log levels: under 5 logs Info and up, 5-8 adds Debug, and over 8 adds Trace (the raw
+//   stats for every check). Lines about a Scale Target carry its target, deployment, namespace, vip
+//   and port as fields.
+//
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//---------------------------------------------------------------------------------
+// setupLogging()  --  Set the log format & level from the config.
+func setupLogging(cfg Configuration) {
+	if cfg.Log_Format == "json" {
+		log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	} else {
+		customFormat := new(log.TextFormatter)
+		customFormat.TimestampFormat = "2006-01-02 15:04:05" // Yes, it MUST be THIS string!
+		customFormat.FullTimestamp = true
+		log.SetFormatter(customFormat)
+	}
+	log.SetLevel(logLevel(cfg.Debug))
+}
+
+// logLevel()  --  Log level for the numeric 'debug' setting.
+func logLevel(debug int) log.Level {
+	switch {
+	case debug > 8:
+		return log.TraceLevel
+	case debug >= 5:
+		return log.DebugLevel
+	}
+	return log.InfoLevel
+}
+
+// logger()  --  Logger for lines about this Scale Target.
+func (t *Target) logger() *log.Entry {
+	return log.WithFields(log.Fields{
+		"target":     t.Cfg.Name,
+		"deployment": t.Cfg.Deployment,
+		"namespace":  t.Cfg.Namespace,
+		"vip":        t.Cfg.SLB,
+		"port":       t.Cfg.SLB_Port,
+	})
+}
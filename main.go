@@ -13,27 +13,29 @@ package main
 //  A10 Networks, Inc.
 //
 import (
+	"context"
 	"flag"
-	"fmt"
 	"io/ioutil"
 	"k8sgo"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"a10/axapi"
 
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v2"
 )
 
 type Configuration struct {
-	Debug    int           `yaml:"debug"`
-	Interval time.Duration `yaml:"check_interval"`
-	Timeout  time.Duration `yaml:"cmd_timeout"`
-	Cluster  struct {
+	Debug      int           `yaml:"debug"`
+	Log_Format string        `yaml:"log_format"` // text or json
+	Interval   time.Duration `yaml:"check_interval"`
+	Timeout    time.Duration `yaml:"cmd_timeout"`
+	Cluster    struct {
 		IP         string `yaml:"ip"`
 		Port       int    `yaml:"port"`
 		Auth_Token string `yaml:"auth_token"`
@@ -43,32 +45,52 @@ type Configuration struct {
 		Max_Pods   int    `yaml:"max_pods"`
 	} `yaml:"cluster"`
 	Thunder struct {
-		IP        string `yaml:"ip"`
-		Port      int    `yaml:"port"`
-		Secret    string `yaml:"secret"`
-		Secret_NS string `yaml:"secret_namespace"`
-		SLB       string `yaml:"slb"`
-		SLB_Port  string `yaml:"slb_port"`
-		Rate      uint64 `yaml:"rate"`
+		IP          string `yaml:"ip"`
+		Port        int    `yaml:"port"`
+		Secret      string `yaml:"secret"`
+		Secret_NS   string `yaml:"secret_namespace"`
+		SLB         string `yaml:"slb"`
+		SLB_Port    string `yaml:"slb_port"`
+		Rate        uint64 `yaml:"rate"`
+		Rate_Source string `yaml:"rate_source"` // gauges (default) or counters
 	} `yaml:"thunder"`
+	Policy     PolicyConfig     `yaml:"policy"`
+	Behavior   BehaviorConfig   `yaml:"behavior"`
+	Drain      DrainConfig      `yaml:"drain"`
+	Predictive PredictConfig    `yaml:"predictive"`
+	Schedules  []ScheduleConfig `yaml:"schedules"`
+	Dry_Run    bool             `yaml:"dry_run"`
+	Leader     LeaderConfig     `yaml:"leader_election"`
+	Audit      AuditConfig      `yaml:"audit"`
+	Retry      RetryConfig      `yaml:"retry"`
+	Breaker    BreakerConfig    `yaml:"circuit_breaker"`
+	Degraded   DegradedConfig   `yaml:"degraded"`
+	CRD        CRDConfig        `yaml:"custom_resources"`
+	HTTP       struct {
+		Listen          string `yaml:"listen"`          // ie. ":8080"; blank to turn off
+		Ready_Intervals int    `yaml:"ready_intervals"` // /readyz fails after this many intervals without a good call
+	} `yaml:"http"`
+	Targets []TargetConfig `yaml:"targets"`
 }
 
 // Global Vars
 var DEBUG int
+var DRY_RUN bool
 var CFG_FILE string
 
+// Scaling work still going on in the background (adjustment checks & drains); waited on at shutdown.
+var inflight sync.WaitGroup
+
 //---------------------------------------------------------------------------------
 // getYamlConfig() - Grab configuration variables from the config YAML file
 func getYamlConfig(fn string) (Configuration, error) {
-	var c Configuration
-
 	yamlFile, err := ioutil.ReadFile(fn)
 	if err != nil {
 		return Configuration{}, err
 	}
-	err = yaml.Unmarshal(yamlFile, &c)
-	if err != nil {
-		return Configuration{}, err
+	c, errs := validateConfig(yamlFile)
+	if len(errs) > 0 {
+		return Configuration{}, configErrors(errs)
 	}
 
 	return c, nil
@@ -77,38 +99,169 @@ func getYamlConfig(fn string) (Configuration, error) {
 //---------------------------------------------------------------------------------
 // procLoop()  --  Processing Loop
 //  This is the main processing loop used to watch the SLB rates and scale the
-//  Deployment as needed.
-func procLoop(d axapi.Device, c k8sgo.Cluster, cfg Configuration) {
+//  Deployments as needed. 'now' is the time of this pass (the simulate command
+//  runs through recorded time).
+func procLoop(ctx context.Context, d thunderAPI, c clusterAPI, cfg Configuration, targets []*Target, now time.Time) {
+	health.tick(now, cfg)
+	if cfg.CRD.Enabled {
+		targets = append(targets[:len(targets):len(targets)], crds.sync(ctx, c, cfg)...)
+	} else {
+		crds.stop()
+	}
+	if len(targets) == 0 {
+		keepalive(ctx, d, cfg) // No A10Autoscaler resources yet
+	}
+	for _, t := range targets {
+		scaleTarget(ctx, d, c, cfg, t, now)
+	}
+	if cfg.CRD.Enabled {
+		crds.writeStatus(ctx, c, cfg, now)
+	}
+}
+
+//---------------------------------------------------------------------------------
+// scaleTarget()  --  Check the SLB rates for a single Scale Target and adjust its Deployment.
+func scaleTarget(ctx context.Context, d thunderAPI, c clusterAPI, cfg Configuration, t *Target, now time.Time) {
+	tc := t.Cfg
+	rec := &auditRecord{
+		Time:       now.UTC().Format(time.RFC3339Nano),
+		Kind:       "evaluation",
+		Target:     tc.Name,
+		Deployment: tc.Namespace + "/" + tc.Deployment,
+		DryRun:     tc.Dry_Run,
+		Action:     "none",
+	}
+	defer audit.write(rec)
+	lg := t.logger()
+	// Hold while Kubernetes is down; there is nothing we could change anyway
+	if !breakers["k8s"].allow(cfg.Breaker, now) {
+		lg.Debug("Kubernetes circuit breaker open, holding Replicas")
+		t.lastErr = "Kubernetes circuit breaker open, holding Replicas"
+		rec.Action, rec.Result = "hold", "circuit breaker open"
+		return
+	}
+	if t.lastGood.IsZero() {
+		t.lastGood = now // Stats count as missing from when the Target was first checked
+	}
 	//
-	// Look up the SLB defined in the configuration and get its current rates
-	port, err := d.GetVSThroughput(cfg.Thunder.SLB, cfg.Thunder.SLB_Port)
-	if err != nil {
-		log.Error(err.Error())
-		// Abort here?
+	// Look up the SLB defined in the configuration and get its current rates. Do not even ask
+	// while the Thunder's circuit breaker is open.
+	var port axapi.PortStats
+	serr := errBreakerOpen
+	if breakers["axapi"].allow(cfg.Breaker, now) {
+		start := time.Now()
+		cctx, cancel := callCtx(ctx, cfg)
+		port, serr = d.GetVSPortStatsCtx(cctx, tc.SLB, tc.SLB_Port)
+		cancel()
+		observeCall("axapi", "GetVSPortStats", start, serr)
 	}
+	t.lastErr = ""
+	if serr != nil {
+		if serr != errBreakerOpen {
+			lg.Error("Getting Port stats: " + serr.Error())
+		}
+		t.lastErr = "Getting stats of '" + tc.SLB + "' port " + tc.SLB_Port + ": " + serr.Error()
+		rec.StatsError = serr.Error()
+	} else {
+		raw := port
+		rec.Stats = &raw
+		t.lastGood = now
+		port = t.portRates(port, now, cfg.Interval, lg)
+	}
+	rec.StatsAge = now.Sub(t.lastGood).Seconds()
 	// Look up current number of replicas for the defined Deployment
-	y, err := c.GetDeploymentStatus(cfg.Cluster.Deployment, cfg.Cluster.Namespace)
+	start := time.Now()
+	cctx, cancel := callCtx(ctx, cfg)
+	y, err := c.GetDeploymentStatusCtx(cctx, tc.Deployment, tc.Namespace)
+	cancel()
+	observeCall("k8s", "GetDeploymentStatus", start, err)
 	if err != nil {
-		log.Fatal(err.Error())
-		ending(2)
-	}
-	if cfg.Debug > 8 {
-		fmt.Println("---------------------------")
-		fmt.Println("replicas running = ", y.CurrentReplicas)
-		fmt.Println("throughput = ", port.Throughput)
+		lg.Error("Getting Deployment: " + err.Error())
+		t.lastErr = "Getting Deployment '" + tc.Deployment + "': " + err.Error()
+		rec.Action, rec.Result = "error", t.lastErr
+		return
 	}
+	lg = lg.WithField("replicas", y.CurrentReplicas)
+	rec.CurrentReplicas = y.CurrentReplicas
 
+	tl := promLabels("target", tc.Name)
+	prom.set("a10_autoscaler_last_evaluation_timestamp_s", tl, float64(now.Unix()))
+	prom.set("a10_autoscaler_current_replicas", tl, float64(y.CurrentReplicas))
+	prom.set("a10_autoscaler_stats_age_seconds", tl, rec.StatsAge)
+	t.current = y.CurrentReplicas
 	//
-	// Compare SLB rate with defined Rate & compute number of replicas required
-	rate := port.Throughput / 1000 // Make it Kbps
-	rpl := int(rate / cfg.Thunder.Rate)
-
-	if cfg.Debug > 8 {
-		fmt.Println("replicas needed = ", rpl)
+	// Dry Run: the policy carries on from what we would have done, not what is really running.
+	// Everything reported keeps the real count, with the simulated one alongside it.
+	current := y.CurrentReplicas
+	t.simulated = 0
+	if tc.Dry_Run {
+		if t.simReplicas > 0 {
+			current = t.simReplicas
+		}
+		t.simulated = current
+		rec.Simulated = current
+		prom.set("a10_autoscaler_simulated_replicas", tl, float64(current))
+	} else {
+		prom.unset("a10_autoscaler_simulated_replicas", tl)
+	}
+	//
+	// Work out the Pod limits, which a schedule may be overriding right now
+	minPods, maxPods, active := bounds(t.scheds, tc.Min_Pods, tc.Max_Pods, now)
+	if a := strings.Join(active, ", "); a != t.active {
+		if a == "" {
+			lg.Info("Schedules ended, Pod limits back to " + strconv.Itoa(minPods) + "-" + strconv.Itoa(maxPods))
+		} else {
+			lg.Info("Schedule(s) " + a + " active, Pod limits now " + strconv.Itoa(minPods) + "-" + strconv.Itoa(maxPods))
+		}
+		t.active = a
+	}
+	prom.set("a10_autoscaler_min_replicas", tl, float64(minPods))
+	prom.set("a10_autoscaler_max_replicas", tl, float64(maxPods))
+	rec.MinReplicas, rec.MaxReplicas, rec.Schedules = minPods, maxPods, active
+	//
+	// Without stats, do what the Target's degraded mode says: missing stats are not zero traffic
+	var rpl int
+	var why string
+	if serr != nil {
+		var ok bool
+		rpl, why, ok = t.degraded(now, maxPods)
+		rec.Reason = why
+		if !ok {
+			lg.Debug("Degraded: " + why)
+			rec.Action, rec.Result = "hold", "no stats"
+			return
+		}
+		lg.Warn("Degraded: " + why)
+		rec.Degraded = tc.Degraded.Action
+	} else {
+		rpl, why = t.evaluate(now, port, current, rec, lg)
+	}
+	rec.Stabilized = rpl
+	rec.Reason = why
+	prom.set("a10_autoscaler_desired_replicas", tl, float64(rpl))
+	t.desired = rpl
+	rec.DesiredReplicas = rpl
+	//
+	// A drain is still scaling the Deployment down: leave it to finish, unless the Pods it is taking away
+	// are needed after all. Then cancel it, which puts them back in service, and carry on from here.
+	if t.isDraining() {
+		need := rpl
+		if need < minPods {
+			need = minPods
+		}
+		if need > maxPods {
+			need = maxPods
+		}
+		if need < current || !t.cancelDrain() {
+			lg.Debug("Still draining, skipped")
+			rec.Action, rec.Result = "skipped", "still draining"
+			return
+		}
+		lg.Info("Replicas needed back up to " + strconv.Itoa(need) + ", drain cancelled")
 	}
 	//
 	// Adjust the number of Replicas, if needed.
-	if rpl != y.CurrentReplicas {
+	if rpl != current || current < minPods || current > maxPods {
 		//
 		// Scaling UP:
 		// This is very simple, as all we really need to do is tell Kubernetes how many more Pods should
@@ -117,121 +270,304 @@ func procLoop(d axapi.Device, c k8sgo.Cluster, cfg Configuration) {
 		// Scaling DOWN:
 		// This is not so simple.  We can always just tell Kubernetes to scale down the number of replicas,
 		// but the problem with this is that connections that are "in flight" will be suddenly cut off if they
-		// are connected to one of the shut-down Pods! The first version of this PoC code just does that...but
-		// what really needs to happen is that this program needs to pick one of the Pods and stop sending
-		// connections to it. If Thunder ADC is only connecting at the K8s Worker node level, it will be impossible
-		// to actually pick the Pod to stop, as the individual Pods are not configured to Thunder. If using IPinIP
-		// tunnels down to the Pod level on K8s, then you CAN pick the individual Pods to stop, tell Thunder ADC to
-		// stop sending new traffic to that Pod, wait for it to show zero connections, THEN tell K8s to stop THAT
-		// PARTICULAR POD.
+		// are connected to one of the shut-down Pods! If Thunder ADC is only connecting at the K8s Worker node
+		// level, that is all we can do, as the individual Pods are not configured to Thunder. If using IPinIP
+		// tunnels down to the Pod level on K8s, turn on 'drain' for the Target: we then pick the Pods to stop,
+		// tell Thunder ADC to stop sending new traffic to them, wait for them to show zero connections, THEN
+		// have K8s stop THOSE PARTICULAR PODS. (See drain.go)
 		if rpl == 0 { // If no traffic, just set to Min_Pods to avoid repeated warnings.
-			rpl = cfg.Cluster.Min_Pods
+			rpl = minPods
+		}
+		want, clamp := rpl, ""
+		if rpl < minPods {
+			lg.Warn("Tried to adjust Replicas below minimum. Adjusting to Minimum.")
+			rpl = minPods
+			clamp = "min"
+			prom.add("a10_autoscaler_clamped_total", promLabels("target", tc.Name, "bound", "min"), 1)
 		}
-		if rpl < cfg.Cluster.Min_Pods {
-			log.Warn("Tried to adjust Replicas below minimum. Adjusting to Minimum.")
-			rpl = cfg.Cluster.Min_Pods
+		if rpl > maxPods {
+			lg.Warn("Tried to adjust Replicas above maximum. Adjusting to Maximum.")
+			rpl = maxPods
+			clamp = "max"
+			prom.add("a10_autoscaler_clamped_total", promLabels("target", tc.Name, "bound", "max"), 1)
+		}
+		// Only tell the app team when the Deployment first hits a limit, not on every pass
+		if clamp != t.clamped && clamp != "" && !tc.Dry_Run {
+			typ := "Normal"
+			if clamp == "max" {
+				typ = "Warning"
+			}
+			event(ctx, c, cfg, lg, y, typ, "A10ScaleClamped", "Wanted "+strconv.Itoa(want)+" Replicas ("+why+"), held to the "+clamp+" of "+strconv.Itoa(rpl))
 		}
-		if rpl > cfg.Cluster.Max_Pods {
-			log.Warn("Tried to adjust Replicas above maximum. Adjusting to Maximum.")
-			rpl = cfg.Cluster.Max_Pods
+		t.clamped = clamp
+		prom.set("a10_autoscaler_desired_replicas", tl, float64(rpl))
+		t.desired = rpl
+		rec.Clamped = clamp
+		rec.DesiredReplicas = rpl
+		inRange := current >= minPods && current <= maxPods
+		if rpl != current && inRange && t.st.inCooldown(now) {
+			lg.Info("Skipping adjustment of Deployment '" + y.Name + "' to " + strconv.Itoa(rpl) + " Replicas: still in cooldown.")
+			rec.Action = "cooldown"
+			return
 		}
-		if rpl != y.CurrentReplicas { // Check if we still need to adjust
+		if rpl != current { // Check if we still need to adjust
 			// Make the adjustment
-			out := "Adjusting Deployment '" + y.Name + "' to " + strconv.Itoa(rpl) + " Replicas."
-			log.Info(out)
-			y, err = c.AdjustDeployment(y, rpl)
-			if err != nil {
-				log.Error(err.Error())
-				// abort here?
+			out := "Adjusting Deployment '" + y.Name + "' to " + strconv.Itoa(rpl) + " Replicas: " + why
+			last := t.st.lastScale
+			t.st.scaled(now)
+			dir := "up"
+			if rpl < current {
+				dir = "down"
 			}
-			//
-			//  Pause here to check and make sure the Cluster adjusts the number of Replicas for the Deployment correctly
-			go func() {
-				timeout := time.After(cfg.Timeout * time.Second)
-				ticker := time.Tick(500 * time.Millisecond)
-				for {
-					select {
-					case <-timeout:
-						log.Error("Adjustment of Replicas Timed Out")
-						return
-					case <-ticker: // Check every half second
-						y, err := c.GetDeploymentStatus(y.Name, y.Namespace)
-						if err != nil {
-							log.Fatal(err.Error())
-							return
-						}
-						if y.CurrentReplicas == rpl { // CurrentReplicas is equal to computed number or Replicas required.
-							log.Info("Adjustment of Cluster is Finished")
-							return
-						}
-					}
+			prom.add("a10_autoscaler_scaling_actions_total", promLabels("target", tc.Name, "direction", dir, "dry_run", strconv.FormatBool(tc.Dry_Run)), 1)
+			rec.Action = "scale_" + dir
+			if tc.Dry_Run {
+				if rpl < current && tc.Drain.Enabled {
+					out = out + " (after draining " + strconv.Itoa(current-rpl) + " Pods)"
 				}
-			}() // This go func() allows the time.Tick() channel to close on the return, and stop firing.
+				lg.Info("[dry-run] " + out)
+				t.simReplicas = rpl
+				rec.Result = "dry-run"
+				return
+			}
+			lg.Info(out)
+			if rpl < current && tc.Drain.Enabled {
+				t.startDrain(ctx, d, c, cfg, lg, y, rpl, why, last)
+				rec.Result = "draining"
+				return
+			}
+			if err := adjust(ctx, c, cfg, lg, y, rpl, why); err != nil {
+				rec.Result = err.Error()
+			} else {
+				rec.Result = "ok"
+			}
 		}
 
+	} else {
+		t.clamped = ""
 	}
 }
 
 //---------------------------------------------------------------------------------
-func main() {
+// evaluate()  --  Work out the Replicas the Target needs from its Port stats: what the Scaling Policy
+// recommends, raised to the forecast when predictive scaling is on, then stabilized.
+func (t *Target) evaluate(now time.Time, port axapi.PortStats, current int, rec *auditRecord, lg *log.Entry) (int, string) {
+	tc := t.Cfg
+	lg.WithFields(log.Fields{
+		"throughput":    port.Throughput,
+		"curr_conn":     port.CurrConn,
+		"curr_req_rate": port.CurrReqRate,
+	}).Trace("Port stats")
 	//
-	// Setup the logging with Timestamps
-	customFormat := new(log.TextFormatter)
-	customFormat.TimestampFormat = "2006-01-02 15:04:05" // Yes, it MUST be THIS string!
-	customFormat.FullTimestamp = true
-	log.SetFormatter(customFormat)
-	log.Info("A10 Kubernetes Autoscaler Starting...")
+	// Compare SLB rates with the Target's metrics & let the Scaling Policy compute number of replicas required
+	raw := metricValues(tc.Metrics, port)
+	vals := t.smoothValues(now, raw)
+	rpl, why := recommend(t.policy, tc.Metrics, vals, current)
+	rec.PolicyReplicas = rpl
+	rec.Metrics = make(map[string]float64)
+	for i, mc := range tc.Metrics {
+		rec.Metrics[mc.Type] = vals[i]
+	}
+	if t.smooth != nil {
+		rec.RawMetrics = make(map[string]float64)
+		for i, mc := range tc.Metrics {
+			rec.RawMetrics[mc.Type] = raw[i]
+		}
+	}
+
+	vl := promLabels("target", tc.Name, "vip", tc.SLB, "port", tc.SLB_Port)
+	prom.set("a10_autoscaler_vip_throughput_bps", vl, float64(port.Throughput))
+	prom.set("a10_autoscaler_vip_current_connections", vl, float64(port.CurrConn))
+	for i, mc := range tc.Metrics {
+		ml := vl + "," + promLabels("metric", mc.Type)
+		prom.set("a10_autoscaler_vip_metric", ml, vals[i])
+		prom.set("a10_autoscaler_vip_metric_raw", ml, raw[i])
+	}
+
+	lg.WithField("needed", rpl).Debug("Replicas needed: " + why)
+	//
+	// Scale ahead of the forecast, but never below what the current rates need
+	if t.pred != nil {
+		t.pred.add(now, vals)
+		if fv, ok := t.pred.forecast(); ok {
+			prpl, pwhy := recommend(t.policy, tc.Metrics, fv, current)
+			rec.Predicted = prpl
+			lg.WithField("predicted", prpl).Debug("Replicas predicted: " + pwhy)
+			if prpl > rpl {
+				rpl = prpl
+				why = "predicted " + pwhy
+			}
+		}
+	}
+	prom.set("a10_autoscaler_policy_replicas", promLabels("target", tc.Name), float64(rpl))
+	//
+	// Smooth out noisy samples using the Stabilization Windows
+	if n, swhy := t.st.stabilize(now, rpl, current); n != rpl {
+		lg.WithField("stabilized", n).Debug("Replicas stabilized: " + swhy)
+		rpl = n
+		why = why + "; " + swhy
+	}
+	return rpl, why
+}
 
+//---------------------------------------------------------------------------------
+// adjust()  --  Set the number of Replicas for the Deployment and watch for the Cluster to catch up.
+// Returns the error if the adjustment could not be made.
+func adjust(ctx context.Context, c clusterAPI, cfg Configuration, lg *log.Entry, y k8sgo.Deployment, rpl int, why string) error {
+	from := y.CurrentReplicas
+	start := time.Now()
+	cctx, cancel := callCtx(ctx, cfg)
+	y, err := c.AdjustDeploymentCtx(cctx, y, rpl)
+	cancel()
+	observeCall("k8s", "AdjustDeployment", start, err)
+	if err != nil {
+		lg.Error("Adjusting Deployment: " + err.Error())
+		return err
+	}
+	reason := "A10ScaledUp"
+	if rpl < from {
+		reason = "A10ScaledDown"
+	}
+	event(ctx, c, cfg, lg, y, "Normal", reason, "Scaled from "+strconv.Itoa(from)+" to "+strconv.Itoa(rpl)+" Replicas: "+why)
+	if cfg.Timeout == 0 {
+		return nil // Nothing to watch (simulate command)
+	}
 	//
-	// Handle Interrrupts
-	sigchan := make(chan os.Signal)
-	signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM)
+	//  Pause here to check and make sure the Cluster adjusts the number of Replicas for the Deployment correctly
+	inflight.Add(1)
 	go func() {
-		<-sigchan
-		ending(1)
-	}()
+		defer inflight.Done()
+		timeout := time.After(cfg.Timeout * time.Second)
+		ticker := time.Tick(500 * time.Millisecond)
+		for {
+			select {
+			case <-timeout:
+				lg.Error("Adjustment of Replicas Timed Out")
+				return
+			case <-ticker: // Check every half second
+				start := time.Now()
+				cctx, cancel := callCtx(context.Background(), cfg) // Carries on through a shut down; ending() waits for it
+				y, err := c.GetDeploymentStatusCtx(cctx, y.Name, y.Namespace)
+				cancel()
+				observeCall("k8s", "GetDeploymentStatus", start, err)
+				if err != nil {
+					lg.Error("Checking adjustment of Replicas: " + err.Error())
+					return
+				}
+				if y.CurrentReplicas == rpl { // CurrentReplicas is equal to computed number or Replicas required.
+					lg.WithField("replicas", rpl).Info("Adjustment of Cluster is Finished")
+					return
+				}
+			}
+		}
+	}() // This go func() allows the time.Tick() channel to close on the return, and stop firing.
+	return nil
+}
+
+//---------------------------------------------------------------------------------
+// event()  --  Post a Kubernetes Event on the Deployment, so app teams can see why it was scaled
+// with 'kubectl describe deployment', without needing the agent's logs.
+func event(ctx context.Context, c clusterAPI, cfg Configuration, lg *log.Entry, y k8sgo.Deployment, typ string, reason string, msg string) {
+	start := time.Now()
+	cctx, cancel := callCtx(ctx, cfg)
+	defer cancel()
+	err := c.CreateEventCtx(cctx, k8sgo.Event{
+		Kind:       "Deployment",
+		APIVersion: "apps/v1",
+		Name:       y.Name,
+		Namespace:  y.Namespace,
+		UID:        y.UID,
+		Type:       typ,
+		Reason:     reason,
+		Message:    msg,
+		Component:  "a10-autoscaler-k8s",
+	})
+	observeCall("k8s", "CreateEvent", start, err)
+	if err != nil {
+		lg.Warn("Cannot post Event on Deployment '" + y.Name + "': " + err.Error())
+	}
+}
+
+//---------------------------------------------------------------------------------
+func main() {
+	//
+	// Commands other than running the autoscaler
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	//
+	// Setup the logging with Timestamps, until the config file says otherwise
+	setupLogging(Configuration{})
+	log.Info("A10 Kubernetes Autoscaler Starting...")
 
 	//
 	// Process commandline args
 	x1 := flag.Int("debug", 0, "Debugging Level")
 	x2 := flag.String("config", "./config.yaml", "Configuration File Path")
+	x3 := flag.Bool("dry-run", false, "Make scaling decisions, but do not change any Deployments")
 	flag.Parse()
 	DEBUG = *x1
+	DRY_RUN = *x3
 	CFG_FILE = *x2
 
 	// Parse config file
-	config, err := getYamlConfig(CFG_FILE)
+	config, err := loadConfig(CFG_FILE)
 	if err != nil {
 		log.Fatal(err)
 	}
+	setupLogging(config)
+	if config.Dry_Run {
+		log.Warn("Dry Run mode: no Deployments will be changed")
+	}
+	if err := audit.open(config.Audit); err != nil {
+		log.Fatal("Cannot open audit log: " + err.Error())
+	}
+
 	//
-	//  command line overrides config file setting for Debug Level.
-	if DEBUG != 0 {
-		config.Debug = DEBUG
+	// Set up the Scale Targets and their Scaling Policies
+	targets, err := newTargets(config)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if config.HTTP.Listen != "" {
+		startHTTP(config.HTTP.Listen)
 	}
 
 	// Query K8s Cluster
 	c := k8sgo.Cluster{}
 	c.URL = config.Cluster.IP + ":" + strconv.Itoa(config.Cluster.Port)
 	c.Token = config.Cluster.Auth_Token
+	c.Retry = config.Retry.k8sRetry()
 	// Make sure we can talk to it
-	_, err = c.GetAllPods()
+	start := time.Now()
+	cctx, cancel := callCtx(context.Background(), config)
+	_, err = c.GetAllPodsCtx(cctx)
+	cancel()
+	observeCall("k8s", "GetAllPods", start, err)
 	if err != nil {
 		log.Fatal(err.Error())
-		ending(2)
 	} else {
 		log.Info("Connected to Kubernetes Cluster")
 	}
 
 	//
 	// Get K8s Secret with Thunder credentials
-	secret, err := c.GetSecret(config.Thunder.Secret, config.Thunder.Secret_NS)
+	cctx, cancel = callCtx(context.Background(), config)
+	secret, err := c.GetSecretCtx(cctx, config.Thunder.Secret, config.Thunder.Secret_NS)
+	cancel()
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 	// fmt.Println(secret.User)
 	// fmt.Println(secret.Passwd)
 
+	//
+	// Handle Interrrupts: from here on, shut down cleanly so the Thunder session is not left behind
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	//
 	// Connect to Thunder node
 	d := axapi.Device{}
@@ -239,34 +575,104 @@ func main() {
 	d.Address = ap
 	d.Username = secret.User
 	d.Password = secret.Passwd
-	d, err = d.Login()
+	d.Retry = config.Retry.axapiRetry()
+	start = time.Now()
+	cctx, cancel = callCtx(ctx, config)
+	d, err = d.LoginCtx(cctx)
+	cancel()
+	observeCall("axapi", "Login", start, err)
 	if err != nil {
 		log.Fatal(err.Error())
 	} else {
 		log.Info("Connected to Thunder Device")
 	}
-	defer d.Logoff()
 
 	//
 	//  Loop for continous rate checking
-	procLoop(d, c, config) // First time through, call direct to avoid initial delay
-	RunProcLoop(d, c, config)
-
+	if config.Leader.Enabled {
+		go runLeaderElection(c, config)
+	}
+	if isLeader(config) {
+		procLoop(ctx, d, c, config, targets, time.Now()) // First time through, call direct to avoid initial delay
+	}
+	config = RunProcLoop(ctx, d, c, config, targets)
+	os.Exit(ending(d, config))
 }
 
 //---------------------------------------------------------------------------------
-//  RunProcLoop() - Handles the timing of calling the Processing Loop
-func RunProcLoop(d axapi.Device, c k8sgo.Cluster, cfg Configuration) {
-	// Run forever.....
-	interval := time.Second * cfg.Interval
-	for range time.Tick(interval) {
-		procLoop(d, c, cfg)
+//  RunProcLoop() - Handles the timing of calling the Processing Loop, and swapping in
+//  a new config when the config file is reloaded. Returns the config in use when 'ctx'
+//  is cancelled.
+func RunProcLoop(ctx context.Context, d axapi.Device, c k8sgo.Cluster, cfg Configuration, targets []*Target) Configuration {
+	reload := make(chan struct{}, 1)
+	go watchConfig(CFG_FILE, reload)
+
+	// Run until shut down.....
+	ticker := time.NewTicker(time.Second * cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Shutting down...")
+			return cfg
+		case <-ticker.C:
+			if isLeader(cfg) {
+				procLoop(ctx, d, c, cfg, targets, time.Now())
+			} else {
+				standby(ctx, d, cfg)
+			}
+		case <-reload:
+			ncfg, nts, err := reloadConfig(CFG_FILE, cfg, targets)
+			if err != nil {
+				log.Error("Config reload rejected, keeping current config: " + err.Error())
+				continue
+			}
+			if ncfg.Interval != cfg.Interval {
+				ticker.Reset(time.Second * ncfg.Interval)
+			}
+			if ncfg.Audit != cfg.Audit {
+				if err := audit.open(ncfg.Audit); err != nil {
+					log.Error("Cannot open audit log: " + err.Error())
+				}
+			}
+			cfg, targets = ncfg, nts
+			d.Retry = cfg.Retry.axapiRetry()
+			c.Retry = cfg.Retry.k8sRetry()
+			setupLogging(cfg)
+			log.Info("Config reloaded, " + strconv.Itoa(len(targets)) + " Target(s)")
+		}
 	}
 }
 
 //---------------------------------------------------------------------------------
-// ending()  --  Tidy up any loose ends before exiting the program.
-func ending(sig int) {
-	// Function to shut things down and end program.
-	os.Exit(sig)
+// ending()  --  Tidy up any loose ends before exiting the program: give scaling that is still going
+// on up to 'cmd_timeout' to finish, then log off the Thunder so the session is not left open.
+// Returns the exit code for the program.
+func ending(d axapi.Device, cfg Configuration) int {
+	code := 0
+	done := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(cfg.Timeout * time.Second):
+		log.Warn("Gave up waiting for scaling in progress to finish")
+		code = 1
+	}
+
+	start := time.Now()
+	cctx, cancel := callCtx(context.Background(), cfg) // 'ctx' is already cancelled by now
+	_, err := d.LogoffCtx(cctx)
+	cancel()
+	observeCall("axapi", "Logoff", start, err)
+	if err != nil {
+		log.Error("Thunder logoff failed: " + err.Error())
+		code = 1
+	} else {
+		log.Info("Logged off Thunder Device")
+	}
+	log.Info("A10 Kubernetes Autoscaler Stopped")
+	return code
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDryRun(t *testing.T) {
+	fn := testAudit(t)
+	f := newFakeDrain(50, 50, 50)
+	tc := TargetConfig{Name: "dry", SLB: "ws-vip", SLB_Port: "80+http", Deployment: "webserver", Namespace: "cyan",
+		Min_Pods: 1, Max_Pods: 10, Metrics: []MetricConfig{{Type: "curr_conn", Target: 100}}, Dry_Run: true}
+	tg, err := newTarget(Configuration{}, tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	tl := promLabels("target", "dry")
+	tests := []struct {
+		name               string
+		conns              uint64
+		dryRun             bool
+		action             string
+		simulated, desired int
+		calls              string
+	}{
+		{"would scale up", 450, true, "scale_up", 3, 5, ""},
+		{"carries on from 5", 450, true, "none", 5, 5, ""},
+		{"would scale down from 5", 250, true, "scale_down", 5, 3, ""},
+		{"dry_run off scales the real Deployment", 450, false, "scale_up", 0, 5, "adjust 5"},
+	}
+	for _, tt := range tests {
+		f.port.CurrConn = tt.conns
+		tg.Cfg.Dry_Run = tt.dryRun
+		scaleTarget(context.Background(), f, f, Configuration{}, tg, now)
+		now = now.Add(10 * time.Second)
+
+		recs := readAudit(t, fn)
+		rec := recs[len(recs)-1]
+		if rec.CurrentReplicas != 3 || rec.Simulated != tt.simulated || rec.DesiredReplicas != tt.desired || rec.Action != tt.action {
+			t.Errorf("%s: audit current %d, simulated %d, desired %d, %s; want 3, %d, %d, %s", tt.name,
+				rec.CurrentReplicas, rec.Simulated, rec.DesiredReplicas, rec.Action, tt.simulated, tt.desired, tt.action)
+		}
+		if tg.current != 3 || tg.simulated != tt.simulated {
+			t.Errorf("%s: status current %d, simulated %d; want 3, %d", tt.name, tg.current, tg.simulated, tt.simulated)
+		}
+		prom.mu.Lock()
+		cur := prom.series["a10_autoscaler_current_replicas"][tl]
+		sim, ok := prom.series["a10_autoscaler_simulated_replicas"][tl]
+		prom.mu.Unlock()
+		if cur != 3 || ok != tt.dryRun || sim != float64(tt.simulated) {
+			t.Errorf("%s: current_replicas %v, simulated_replicas %v (set %v); want 3, %d", tt.name, cur, sim, ok, tt.simulated)
+		}
+		if got := f.called(); got != tt.calls {
+			t.Errorf("%s: calls = %q, want %q", tt.name, got, tt.calls)
+		}
+	}
+	prom.forget("dry")
+}
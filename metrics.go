@@ -0,0 +1,103 @@
+package main
+
+//
+//  metrics.go
+//   The SLB Virtual Server Port stats that a Scale Target can be scaled on. Each metric configured
+//   for a Target is run through its Scaling Policy on its own, and the highest recommendation wins.
+//
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"a10/axapi"
+)
+
+// MetricConfig is one entry of a Target's 'metrics' list.
+//  For load metrics (throughput, connections, request rates) 'target' is the amount each Pod should handle.
+//  For latency metrics 'target' is the response time wanted for the Virtual Server Port as a whole.
+type MetricConfig struct {
+	Type      string       `yaml:"type"`
+	Target    float64      `yaml:"target"`
+	Smoothing SmoothConfig `yaml:"smoothing"` // Smooth the values before the Scaling Policy sees them
+}
+
+type metricDef struct {
+	get     func(axapi.PortStats) float64
+	latency bool // Value does not split across Pods
+}
+
+var metricDefs = map[string]metricDef{
+	"throughput":                 {get: func(s axapi.PortStats) float64 { return float64(s.Throughput) / 1000 }}, // Kbps
+	"curr_conn":                  {get: func(s axapi.PortStats) float64 { return float64(s.CurrConn) }},
+	"curr_ssl_conn":              {get: func(s axapi.PortStats) float64 { return float64(s.CurrSSLConn) }},
+	"curr_req":                   {get: func(s axapi.PortStats) float64 { return float64(s.CurrReq) }},
+	"curr_req_rate":              {get: func(s axapi.PortStats) float64 { return float64(s.CurrReqRate) }},
+	"curr_conn_rate":             {get: func(s axapi.PortStats) float64 { return float64(s.CurrConnRate) }},
+	"curr_resp_rate":             {get: func(s axapi.PortStats) float64 { return float64(s.CurrRespRate) }},
+	"last_rsp_time":              {get: func(s axapi.PortStats) float64 { return float64(s.LastRspTime) }, latency: true},
+	"backend-time-to-first-byte": {get: func(s axapi.PortStats) float64 { return float64(s.BackendTimeToFirstByte) }, latency: true},
+	"backend-time-to-last-byte":  {get: func(s axapi.PortStats) float64 { return float64(s.BackendTimeToLastByte) }, latency: true},
+	"in-latency":                 {get: func(s axapi.PortStats) float64 { return float64(s.InLatency) }, latency: true},
+	"out-latency":                {get: func(s axapi.PortStats) float64 { return float64(s.OutLatency) }, latency: true},
+}
+
+//---------------------------------------------------------------------------------
+// checkMetric()  --  Make sure a metric type is one we know how to scale on.
+func checkMetric(mc MetricConfig) error {
+	if _, ok := metricDefs[mc.Type]; !ok {
+		var names []string
+		for n := range metricDefs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return errors.New("Unknown metric type '" + mc.Type + "' (valid: " + strings.Join(names, ", ") + ")")
+	}
+	if mc.Target <= 0 {
+		return errors.New("metric '" + mc.Type + "' needs a 'target' greater than zero")
+	}
+	if err := checkSmoothing(mc.Smoothing); err != nil {
+		return errors.New("metric '" + mc.Type + "': " + err.Error())
+	}
+	return nil
+}
+
+//---------------------------------------------------------------------------------
+// metricValues()  --  Pull the value of each of the Target's metrics out of the Port stats.
+func metricValues(mcs []MetricConfig, ps axapi.PortStats) []float64 {
+	vals := make([]float64, len(mcs))
+	for i, mc := range mcs {
+		vals[i] = metricDefs[mc.Type].get(ps)
+	}
+	return vals
+}
+
+//---------------------------------------------------------------------------------
+// observe()  --  Turn a metric value into an Observation for the Scaling Policy.
+// Latency metrics do not go down by adding Pods in a straight line, so they are handed
+// to the policy scaled by the current Replicas; that way every policy works out to
+// current * (observed / target) Pods.
+func observe(mc MetricConfig, v float64, current int) Observation {
+	if metricDefs[mc.Type].latency {
+		n := current
+		if n < 1 {
+			n = 1
+		}
+		v = v * float64(n)
+	}
+	return Observation{Name: mc.Type, Value: v, Target: mc.Target}
+}
+
+//---------------------------------------------------------------------------------
+// recommend()  --  Run every metric through the Scaling Policy and take the highest recommendation.
+// vals holds the value for each entry of mcs.
+func recommend(p ScalingPolicy, mcs []MetricConfig, vals []float64, current int) (int, string) {
+	rpl, why := 0, ""
+	for i, mc := range mcs {
+		n, r := p.Desired(observe(mc, vals[i], current), current)
+		if i == 0 || n > rpl {
+			rpl, why = n, r
+		}
+	}
+	return rpl, why
+}
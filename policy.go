@@ -0,0 +1,123 @@
+package main
+
+//
+//  policy.go
+//   Scaling Policies used by procLoop() to turn the metrics observed on a Thunder SLB Virtual Server Port
+//   into the number of Replicas the Deployment should be running.
+//
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Observation is a single metric reading handed to a ScalingPolicy.
+type Observation struct {
+	Name   string  // Metric name, ie. "throughput"
+	Value  float64 // Value observed for the whole Virtual Server Port
+	Target float64 // Value each Pod is expected to handle
+}
+
+// ScalingPolicy computes the number of Replicas wanted for an Observation, given the number
+// of Replicas currently running. The string returned explains the decision for the logs.
+type ScalingPolicy interface {
+	Desired(obs Observation, current int) (int, string)
+}
+
+// PolicyConfig is the 'policy' section of the config file.
+type PolicyConfig struct {
+	Type      string       `yaml:"type"`      // target-tracking, step, or proportional
+	Tolerance float64      `yaml:"tolerance"` // proportional: ignore changes when usage ratio is within 1 +/- tolerance
+	Steps     []StepConfig `yaml:"steps"`     // step: adjustments to make, checked in order
+}
+
+// StepConfig is one step of the step scaling policy. Bounds are the percent of the target
+// rate used per running Pod. An Upper of zero means there is no upper bound.
+type StepConfig struct {
+	Lower  float64 `yaml:"lower"`
+	Upper  float64 `yaml:"upper"`
+	Change int     `yaml:"change"`
+}
+
+const defaultTolerance = 0.1
+
+//---------------------------------------------------------------------------------
+// newPolicy()  --  Build the ScalingPolicy described by the config file.
+func newPolicy(pc PolicyConfig) (ScalingPolicy, error) {
+	switch pc.Type {
+	case "", "target-tracking":
+		return targetTracking{}, nil
+	case "step":
+		if len(pc.Steps) == 0 {
+			return nil, errors.New("step policy requires at least one entry in 'steps'")
+		}
+		return stepScaling{steps: pc.Steps}, nil
+	case "proportional":
+		t := pc.Tolerance
+		if t == 0 {
+			t = defaultTolerance
+		}
+		if t < 0 {
+			return nil, errors.New("proportional policy 'tolerance' cannot be negative")
+		}
+		return proportional{tolerance: t}, nil
+	}
+	return nil, errors.New("Unknown scaling policy type '" + pc.Type + "'")
+}
+
+//---------------------------------------------------------------------------------
+// targetTracking  --  Run enough Pods so none of them is over the target rate.
+type targetTracking struct{}
+
+func (p targetTracking) Desired(obs Observation, current int) (int, string) {
+	if obs.Target <= 0 {
+		return current, "no target set for " + obs.Name
+	}
+	n := int(math.Ceil(obs.Value / obs.Target))
+	return n, fmt.Sprintf("%s %.0f / target %.0f per Pod", obs.Name, obs.Value, obs.Target)
+}
+
+//---------------------------------------------------------------------------------
+// stepScaling  --  Add or remove a fixed number of Pods depending on how far the per Pod
+// usage is from the target rate.
+type stepScaling struct {
+	steps []StepConfig
+}
+
+func (p stepScaling) Desired(obs Observation, current int) (int, string) {
+	if obs.Target <= 0 {
+		return current, "no target set for " + obs.Name
+	}
+	pods := current
+	if pods < 1 {
+		pods = 1
+	}
+	usage := obs.Value / float64(pods) / obs.Target * 100
+	for _, s := range p.steps {
+		if usage >= s.Lower && (s.Upper == 0 || usage < s.Upper) {
+			return current + s.Change, fmt.Sprintf("%s at %.1f%% of target per Pod, step change %+d", obs.Name, usage, s.Change)
+		}
+	}
+	return current, fmt.Sprintf("%s at %.1f%% of target per Pod, no step matched", obs.Name, usage)
+}
+
+//---------------------------------------------------------------------------------
+// proportional  --  Scale the current Replicas by the ratio of usage to target, the same way the
+// Kubernetes HPA does, but leave things alone while the ratio is within the tolerance.
+type proportional struct {
+	tolerance float64
+}
+
+func (p proportional) Desired(obs Observation, current int) (int, string) {
+	if obs.Target <= 0 {
+		return current, "no target set for " + obs.Name
+	}
+	if current < 1 {
+		return int(math.Ceil(obs.Value / obs.Target)), obs.Name + " with no running Pods"
+	}
+	ratio := obs.Value / (float64(current) * obs.Target)
+	if math.Abs(ratio-1.0) <= p.tolerance {
+		return current, fmt.Sprintf("%s usage ratio %.2f within tolerance %.2f", obs.Name, ratio, p.tolerance)
+	}
+	return int(math.Ceil(ratio * float64(current))), fmt.Sprintf("%s usage ratio %.2f", obs.Name, ratio)
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestPolicyDesired(t *testing.T) {
+	steps := []StepConfig{
+		{Lower: 0, Upper: 30, Change: -1},
+		{Lower: 30, Upper: 80, Change: 0},
+		{Lower: 80, Upper: 150, Change: 1},
+		{Lower: 150, Change: 3},
+	}
+	tests := []struct {
+		name    string
+		pc      PolicyConfig
+		value   float64
+		target  float64
+		current int
+		want    int
+	}{
+		{"tracking exact", PolicyConfig{}, 100, 20, 3, 5},
+		{"tracking rounds up", PolicyConfig{Type: "target-tracking"}, 101, 20, 3, 6},
+		{"tracking idle", PolicyConfig{}, 0, 20, 3, 0},
+		{"tracking no target", PolicyConfig{}, 100, 0, 3, 3},
+		{"step low", PolicyConfig{Type: "step", Steps: steps}, 20, 10, 10, 9},      // 20%
+		{"step in band", PolicyConfig{Type: "step", Steps: steps}, 50, 10, 10, 10}, // 50%
+		{"step lower bound", PolicyConfig{Type: "step", Steps: steps}, 80, 10, 10, 11},
+		{"step no upper", PolicyConfig{Type: "step", Steps: steps}, 500, 10, 10, 13},
+		{"step no pods", PolicyConfig{Type: "step", Steps: steps}, 20, 10, 0, 3}, // 200% of one Pod
+		{"step no match", PolicyConfig{Type: "step", Steps: steps[1:2]}, 10, 10, 10, 10},
+		{"proportional up", PolicyConfig{Type: "proportional"}, 150, 10, 10, 15},
+		{"proportional down", PolicyConfig{Type: "proportional"}, 40, 10, 10, 4},
+		{"proportional in tolerance", PolicyConfig{Type: "proportional"}, 109, 10, 10, 10},
+		{"proportional edge of tolerance", PolicyConfig{Type: "proportional", Tolerance: 0.2}, 80, 10, 10, 10},
+		{"proportional no pods", PolicyConfig{Type: "proportional"}, 25, 10, 0, 3},
+	}
+	for _, tt := range tests {
+		p, err := newPolicy(tt.pc)
+		if err != nil {
+			t.Errorf("%s: newPolicy() = %v", tt.name, err)
+			continue
+		}
+		got, why := p.Desired(Observation{Name: "throughput", Value: tt.value, Target: tt.target}, tt.current)
+		if got != tt.want {
+			t.Errorf("%s: Desired() = %d (%s), want %d", tt.name, got, why, tt.want)
+		}
+	}
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	for _, pc := range []PolicyConfig{
+		{Type: "bogus"},
+		{Type: "step"},
+		{Type: "proportional", Tolerance: -0.1},
+	} {
+		if _, err := newPolicy(pc); err == nil {
+			t.Errorf("newPolicy(%+v) = nil error, want an error", pc)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+//
+//  predict.go
+//   Predictive scaling. Keeps a history of each metric a Target scales on and forecasts the highest it
+//   will get over the next 'horizon' seconds, so Pods can be started before the traffic gets there; a
+//   peak part way through the horizon counts as much as one at the end of it. The forecast only
+//   ever adds Pods: procLoop() uses whichever is higher, the reactive or the predicted recommendation.
+//
+//   Methods:
+//    linear        -- least squares trend line over the history.
+//    holt-winters  -- additive Holt-Winters with a 'season' long cycle (ie. daily traffic patterns).
+//                     Needs two full seasons of history; until then the linear trend is used.
+//
+//   Samples are placed by their timestamp, one per 'check_interval', so a missed pass or two passes
+//   close together do not move where in the season the samples after them fall.
+//
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// PredictConfig is the 'predictive' section of a Target. Times are in seconds.
+type PredictConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Method  string        `yaml:"method"`  // linear or holt-winters
+	Horizon time.Duration `yaml:"horizon"` // How far ahead to forecast
+	History time.Duration `yaml:"history"` // How much history to keep
+	Season  time.Duration `yaml:"season"`  // holt-winters: length of one cycle
+	Alpha   float64       `yaml:"alpha"`   // holt-winters: level smoothing
+	Beta    float64       `yaml:"beta"`    // holt-winters: trend smoothing
+	Gamma   float64       `yaml:"gamma"`   // holt-winters: seasonal smoothing
+}
+
+const (
+	defaultHorizon = 300
+	defaultHistory = 3600
+	defaultSeason  = 86400
+	defaultAlpha   = 0.5
+	defaultBeta    = 0.1
+	defaultGamma   = 0.3
+	minSamples     = 6 // Need at least this much history before forecasting
+)
+
+type sample struct {
+	at   time.Time
+	step int64 // Number of the interval 'at' falls in, counted from the Unix epoch
+	vals []float64
+}
+
+// predictor holds the metric history for a Target.
+type predictor struct {
+	cfg      PredictConfig
+	interval time.Duration // Expected time between samples
+	hist     []sample
+}
+
+//---------------------------------------------------------------------------------
+// newPredictor()  --  Set up a predictor, filling in defaults. Returns nil if predictive scaling is off.
+func newPredictor(pc PredictConfig, interval time.Duration) (*predictor, error) {
+	if !pc.Enabled {
+		return nil, nil
+	}
+	switch pc.Method {
+	case "":
+		pc.Method = "linear"
+	case "linear", "holt-winters":
+	default:
+		return nil, errors.New("Unknown predictive method '" + pc.Method + "'")
+	}
+	if pc.Horizon == 0 {
+		pc.Horizon = defaultHorizon
+	}
+	if pc.Season == 0 {
+		pc.Season = defaultSeason
+	}
+	if pc.History == 0 {
+		pc.History = defaultHistory
+		if pc.Method == "holt-winters" {
+			// A season more than the two needed, so a late start or gaps do not hold it off
+			pc.History = 3 * pc.Season
+		}
+	}
+	if pc.Alpha == 0 {
+		pc.Alpha = defaultAlpha
+	}
+	if pc.Beta == 0 {
+		pc.Beta = defaultBeta
+	}
+	if pc.Gamma == 0 {
+		pc.Gamma = defaultGamma
+	}
+	for _, f := range []float64{pc.Alpha, pc.Beta, pc.Gamma} {
+		if f < 0 || f > 1 {
+			return nil, errors.New("predictive alpha, beta and gamma must be between 0 and 1")
+		}
+	}
+	if interval <= 0 {
+		interval = 1
+	}
+	return &predictor{cfg: pc, interval: interval}, nil
+}
+
+//---------------------------------------------------------------------------------
+// add()  --  Record the metric values seen on this pass, and drop history that is too old.
+func (p *predictor) add(now time.Time, vals []float64) {
+	// A config change may have changed the number of metrics; start over if so.
+	if len(p.hist) > 0 && len(p.hist[0].vals) != len(vals) {
+		p.hist = nil
+	}
+	s := sample{at: now, step: p.stepOf(now), vals: vals}
+	if n := len(p.hist); n > 0 && p.hist[n-1].step == s.step {
+		p.hist[n-1] = s // Two passes in the same interval: keep the later one
+	} else {
+		p.hist = append(p.hist, s)
+	}
+	cutoff := now.Add(-p.cfg.History * time.Second)
+	i := 0
+	for i < len(p.hist) && p.hist[i].at.Before(cutoff) {
+		i++
+	}
+	p.hist = p.hist[i:]
+}
+
+// stepOf()  --  Number of the interval a time falls in, rounded to the nearest one.
+func (p *predictor) stepOf(t time.Time) int64 {
+	d := int64(p.interval * time.Second)
+	return (t.UnixNano() + d/2) / d
+}
+
+//---------------------------------------------------------------------------------
+// forecast()  --  Predict the highest each metric gets over the 'horizon' seconds after the last
+// sample. Returns false if there is not enough history yet.
+func (p *predictor) forecast() ([]float64, bool) {
+	if len(p.hist) < minSamples {
+		return nil, false
+	}
+	n := len(p.hist[0].vals)
+	out := make([]float64, n)
+	for m := 0; m < n; m++ {
+		var f float64
+		season := int(p.cfg.Season / p.interval)
+		if p.cfg.Method == "holt-winters" && season > 1 && p.seasonal(season) {
+			f = p.holtWinters(m, season)
+		} else {
+			f = p.linear(m)
+		}
+		out[m] = math.Max(f, 0)
+	}
+	return out, true
+}
+
+// linear()  --  Fit a least squares line to metric m and extend it out to the horizon. A line peaks at
+// one end or the other, so the higher of the next sample and the horizon is the peak.
+func (p *predictor) linear(m int) float64 {
+	t0 := p.hist[0].at
+	var sx, sy, sxx, sxy float64
+	for _, s := range p.hist {
+		x := s.at.Sub(t0).Seconds()
+		y := s.vals[m]
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	k := float64(len(p.hist))
+	den := k*sxx - sx*sx
+	if den == 0 {
+		return p.hist[len(p.hist)-1].vals[m]
+	}
+	slope := (k*sxy - sx*sy) / den
+	icept := (sy - slope*sx) / k
+	x := p.hist[len(p.hist)-1].at.Sub(t0).Seconds()
+	return icept + slope*x + math.Max(slope*float64(p.interval), slope*float64(p.cfg.Horizon))
+}
+
+// seasonal()  --  True if the history spans two seasons of 'season' intervals, with a sample in at
+// least half of the intervals; any fewer and the filled in gaps would make up most of the profile.
+func (p *predictor) seasonal(season int) bool {
+	span := p.hist[len(p.hist)-1].step - p.hist[0].step + 1
+	return span >= int64(2*season) && int64(len(p.hist))*2 >= span
+}
+
+// series()  --  Metric m for every interval from the first sample to the last. Intervals with no
+// sample are filled in on a straight line between the samples either side.
+func (p *predictor) series(m int) []float64 {
+	first := p.hist[0].step
+	y := make([]float64, p.hist[len(p.hist)-1].step-first+1)
+	for i, s := range p.hist {
+		y[s.step-first] = s.vals[m]
+		if i == 0 {
+			continue
+		}
+		prev := p.hist[i-1]
+		gap := s.step - prev.step
+		for k := int64(1); k < gap; k++ {
+			y[prev.step-first+k] = prev.vals[m] + float64(k)/float64(gap)*(s.vals[m]-prev.vals[m])
+		}
+	}
+	return y
+}
+
+// holtWinters()  --  Additive Holt-Winters forecast of metric m; the highest over each step out to the
+// horizon. 'season' is the number of intervals in one cycle. Where an interval falls in the season is
+// worked out from its timestamp, so it is the same from one season to the next.
+func (p *predictor) holtWinters(m int, season int) float64 {
+	y := p.series(m)
+	first := p.hist[0].step
+	phase := func(i int) int { return int((first + int64(i)) % int64(season)) }
+
+	// Initial level, trend & seasonal components from the first two seasons
+	var s1, s2 float64
+	for i := 0; i < season; i++ {
+		s1 += y[i]
+		s2 += y[season+i]
+	}
+	level := s1 / float64(season)
+	trend := (s2 - s1) / float64(season*season)
+	seas := make([]float64, season)
+	for i := 0; i < season; i++ {
+		seas[phase(i)] = y[i] - level
+	}
+
+	a, b, g := p.cfg.Alpha, p.cfg.Beta, p.cfg.Gamma
+	for i := season; i < len(y); i++ {
+		si := phase(i)
+		last := level
+		level = a*(y[i]-seas[si]) + (1-a)*(level+trend)
+		trend = b*(level-last) + (1-b)*trend
+		seas[si] = g*(y[i]-level) + (1-g)*seas[si]
+	}
+
+	h := int(p.cfg.Horizon / p.interval)
+	if h < 1 {
+		h = 1
+	}
+	peak := math.Inf(-1)
+	for k := 1; k <= h; k++ {
+		peak = math.Max(peak, level+float64(k)*trend+seas[phase(len(y)-1+k)])
+	}
+	return peak
+}
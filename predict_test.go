@@ -0,0 +1,191 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewPredictor(t *testing.T) {
+	tests := []struct {
+		pc      PredictConfig
+		nilPred bool
+		err     bool
+	}{
+		{PredictConfig{}, true, false},
+		{PredictConfig{Enabled: true}, false, false},
+		{PredictConfig{Enabled: true, Method: "holt-winters"}, false, false},
+		{PredictConfig{Enabled: true, Method: "arima"}, true, true},
+		{PredictConfig{Enabled: true, Alpha: 1.5}, true, true},
+	}
+	for _, tt := range tests {
+		p, err := newPredictor(tt.pc, 10)
+		if (p == nil) != tt.nilPred || (err != nil) != tt.err {
+			t.Errorf("newPredictor(%+v) = %v, %v", tt.pc, p, err)
+		}
+	}
+}
+
+// feed()  --  Add one sample of a single metric every 'step' seconds.
+func feed(p *predictor, t0 time.Time, step int, vals ...float64) time.Time {
+	now := t0
+	for i, v := range vals {
+		now = t0.Add(time.Duration(i*step) * time.Second)
+		p.add(now, []float64{v})
+	}
+	return now
+}
+
+func TestForecast(t *testing.T) {
+	tests := []struct {
+		name string
+		pc   PredictConfig
+		vals []float64 // One every 10 seconds
+		want float64
+		ok   bool
+	}{
+		{"too little history", PredictConfig{Enabled: true, Horizon: 60},
+			[]float64{10, 20, 30}, 0, false},
+		{"rising line, peak at the horizon", PredictConfig{Enabled: true, Horizon: 60},
+			[]float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}, 150, true},
+		{"falling line, peak at the next sample", PredictConfig{Enabled: true, Horizon: 60},
+			[]float64{200, 190, 180, 170, 160, 150, 140, 130, 120, 110}, 100, true},
+		{"never below zero", PredictConfig{Enabled: true, Horizon: 600},
+			[]float64{50, 40, 30, 20, 10, 5}, 0, true},
+		{"flat", PredictConfig{Enabled: true, Horizon: 60},
+			[]float64{7, 7, 7, 7, 7, 7}, 7, true},
+		{"holt-winters follows the season", PredictConfig{Enabled: true, Method: "holt-winters", Season: 40, Horizon: 30},
+			[]float64{10, 20, 30, 20, 10, 20, 30, 20, 10, 20, 30, 20}, 30, true},
+		{"holt-winters uses the line until it has two seasons", PredictConfig{Enabled: true, Method: "holt-winters", Season: 100, Horizon: 60},
+			[]float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}, 150, true},
+	}
+	t0 := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		p, err := newPredictor(tt.pc, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		feed(p, t0, 10, tt.vals...)
+		f, ok := p.forecast()
+		if ok != tt.ok {
+			t.Errorf("%s: forecast() ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && math.Abs(f[0]-tt.want) > 1e-6 {
+			t.Errorf("%s: forecast() = %v, want %v", tt.name, f[0], tt.want)
+		}
+	}
+}
+
+func TestPredictorHistory(t *testing.T) {
+	p, _ := newPredictor(PredictConfig{Enabled: true, History: 60}, 10)
+	now := feed(p, time.Unix(1700000000, 0), 10, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	if len(p.hist) != 7 || !p.hist[0].at.Equal(now.Add(-60*time.Second)) {
+		t.Errorf("%d samples kept from %v, want 7 from 60s before %v", len(p.hist), p.hist[0].at, now)
+	}
+	// A change in the number of metrics starts the history over
+	p.add(now.Add(10*time.Second), []float64{1, 2})
+	if len(p.hist) != 1 {
+		t.Errorf("%d samples kept after the metrics changed, want 1", len(p.hist))
+	}
+}
+
+func TestForecastSeasonal(t *testing.T) {
+	// Three seasons of 4 intervals, peaking at 30 in the third interval of each
+	pattern := []float64{10, 20, 30, 20, 10, 20, 30, 20, 10, 20, 30, 20}
+	type pt struct {
+		at int // Seconds from the start of a season
+		v  float64
+	}
+	every := func(vals []float64) []pt {
+		var pts []pt
+		for i, v := range vals {
+			pts = append(pts, pt{i * 10, v})
+		}
+		return pts
+	}
+	without := func(pts []pt, drop ...int) []pt {
+		var out []pt
+		for i, p := range pts {
+			keep := true
+			for _, d := range drop {
+				keep = keep && i != d
+			}
+			if keep {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+	jittered := every(pattern)
+	for i := range jittered {
+		jittered[i].at += []int{3, -4, 0, 2}[i%4]
+	}
+	doubled := every(pattern)
+	doubled = append(doubled[:7], append([]pt{{62, 30}}, doubled[7:]...)...)
+
+	tests := []struct {
+		name     string
+		pc       PredictConfig
+		pts      []pt
+		seasonal bool // Else the linear trend is used
+	}{
+		{"on time", PredictConfig{}, every(pattern), true},
+		{"late and early passes", PredictConfig{}, jittered, true},
+		{"missed pass", PredictConfig{}, without(every(pattern), 5), true},
+		{"two passes in one interval", PredictConfig{}, doubled, true},
+		{"missed pass in the first two seasons", PredictConfig{}, without(every(pattern[:8]), 5), true},
+		{"less than two seasons", PredictConfig{}, every(pattern[:7]), false},
+		{"too many missed passes", PredictConfig{History: 200}, without(every(append(pattern, pattern[:4]...)), 1, 2, 3, 5, 6, 9, 10, 13, 14), false},
+		{"history shorter than two seasons", PredictConfig{History: 60}, every(pattern), false},
+	}
+	t0 := time.Unix(1700000000, 0) // The start of a season
+	for _, tt := range tests {
+		pc := tt.pc
+		pc.Enabled, pc.Method, pc.Season, pc.Horizon = true, "holt-winters", 40, 30
+		p, err := newPredictor(pc, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, x := range tt.pts {
+			p.add(t0.Add(time.Duration(x.at)*time.Second), []float64{x.v})
+		}
+		f, ok := p.forecast()
+		if !ok {
+			t.Errorf("%s: no forecast", tt.name)
+			continue
+		}
+		want := p.linear(0)
+		if tt.seasonal {
+			want = 30
+		}
+		if math.Abs(f[0]-math.Max(want, 0)) > 1e-6 {
+			t.Errorf("%s: forecast() = %v, want %v", tt.name, f[0], want)
+		}
+	}
+}
+
+func TestPredictClampedToMax(t *testing.T) {
+	config := strings.Replace(testConfig, "    rate: 20\n",
+		"    metrics:\n      - type: curr_conn\n        target: 100\n    predictive:\n      enabled: true\n      horizon: 300\n", 1)
+	config = strings.Replace(config, "max_pods: 10", "max_pods: 3", 1)
+	// Rising by 20 connections every interval
+	var b strings.Builder
+	b.WriteString("time,curr_conn\n")
+	for i := 0; i <= 12; i++ {
+		b.WriteString(strconv.Itoa(1704067200+i*10) + "," + strconv.Itoa(20+i*20) + "\n")
+	}
+	rows := simTimeline(t, config, b.String(), "-startup", "0")
+	for i, r := range rows {
+		n, _ := strconv.Atoi(r[2])
+		switch {
+		case n > 3:
+			t.Errorf("row %d = %v, scaled past max_pods 3", i, r)
+		case i >= 5 && n != 3:
+			// 120 connections only need 2 Pods, but the forecast needs more than max_pods
+			t.Errorf("row %d = %v, want the forecast to scale to max_pods 3", i, r)
+		}
+	}
+}
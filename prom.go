@@ -0,0 +1,162 @@
+package main
+
+//
+//  prom.go
+//   Prometheus metrics for what the agent sees and decides, served in the Prometheus text format
+//   on /metrics. Kept to a simple hand rolled registry so the agent does not need the full
+//   Prometheus client library.
+//
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// promMetric describes one metric family.
+type promMetric struct {
+	typ  string // gauge or counter
+	help string
+}
+
+var promMetrics = map[string]promMetric{
+	"a10_autoscaler_vip_throughput_bps":           {"gauge", "Throughput of the SLB Virtual Server Port in bits per second."},
+	"a10_autoscaler_vip_current_connections":      {"gauge", "Current connections on the SLB Virtual Server Port."},
+	"a10_autoscaler_vip_metric":                   {"gauge", "Value of each metric a Target scales on, as used by the Scaling Policy (after any smoothing)."},
+	"a10_autoscaler_vip_metric_raw":               {"gauge", "Value of each metric a Target scales on, before smoothing."},
+	"a10_autoscaler_policy_replicas":              {"gauge", "Replicas recommended by the Scaling Policy, before stabilization and limits."},
+	"a10_autoscaler_desired_replicas":             {"gauge", "Replicas the Deployment should have after stabilization and limits."},
+	"a10_autoscaler_current_replicas":             {"gauge", "Replicas the Deployment has."},
+	"a10_autoscaler_simulated_replicas":           {"gauge", "Replicas a dry_run Target would have given the Deployment by now."},
+	"a10_autoscaler_min_replicas":                 {"gauge", "Lower Replica limit in effect, including schedules."},
+	"a10_autoscaler_max_replicas":                 {"gauge", "Upper Replica limit in effect, including schedules."},
+	"a10_autoscaler_clamped_total":                {"counter", "Times the recommended Replicas were held to the min or max limit."},
+	"a10_autoscaler_scaling_actions_total":        {"counter", "Scaling actions taken, by direction."},
+	"a10_autoscaler_api_call_duration_seconds":    {"summary", "Time taken by aXAPI and Kubernetes API calls."},
+	"a10_autoscaler_api_errors_total":             {"counter", "aXAPI and Kubernetes API calls that failed."},
+	"a10_autoscaler_last_evaluation_timestamp_s":  {"gauge", "Unix time a Target was last evaluated."},
+	"a10_autoscaler_stats_age_seconds":            {"gauge", "Seconds since a Target last got good stats from the Thunder."},
+	"a10_autoscaler_circuit_breaker_open":         {"gauge", "1 while the circuit breaker for the aXAPI or Kubernetes API is open and scaling is held."},
+	"a10_autoscaler_circuit_breaker_opened_total": {"counter", "Times the circuit breaker for the aXAPI or Kubernetes API has opened."},
+}
+
+// promRegistry holds the current value of every series: metric name -> labels -> value.
+type promRegistry struct {
+	mu     sync.Mutex
+	series map[string]map[string]float64
+}
+
+var prom = &promRegistry{series: make(map[string]map[string]float64)}
+
+// promLabels()  --  Build a label set from name/value pairs, ie. promLabels("target", "web").
+func promLabels(kv ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		b.WriteString(kv[i] + `="` + v + `"`)
+	}
+	return b.String()
+}
+
+func (r *promRegistry) set(name string, labels string, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.series[name] == nil {
+		r.series[name] = make(map[string]float64)
+	}
+	r.series[name][labels] = v
+}
+
+func (r *promRegistry) add(name string, labels string, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.series[name] == nil {
+		r.series[name] = make(map[string]float64)
+	}
+	r.series[name][labels] += v
+}
+
+// unset()  --  Drop a single series, ie. one that only applies in dry_run.
+func (r *promRegistry) unset(name string, labels string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.series[name], labels)
+}
+
+// forget()  --  Drop every series for a Target that is no longer configured.
+func (r *promRegistry) forget(target string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l := promLabels("target", target)
+	for _, s := range r.series {
+		for k := range s {
+			if k == l || strings.HasPrefix(k, l+",") {
+				delete(s, k)
+			}
+		}
+	}
+}
+
+// write()  --  Write out every series in the Prometheus text format.
+func (r *promRegistry) write(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for n := range promMetrics {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		s := r.series[n]
+		pm := promMetrics[n]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", n, pm.help, n, pm.typ)
+		var keys []string
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if pm.typ == "summary" {
+			// Stored as name_sum & name_count under the family name
+			for _, k := range keys {
+				i := strings.LastIndex(k, "|")
+				fmt.Fprintf(w, "%s_%s{%s} %s\n", n, k[i+1:], k[:i], strconv.FormatFloat(s[k], 'g', -1, 64))
+			}
+			continue
+		}
+		for _, k := range keys {
+			if k == "" {
+				fmt.Fprintf(w, "%s %s\n", n, strconv.FormatFloat(s[k], 'g', -1, 64))
+			} else {
+				fmt.Fprintf(w, "%s{%s} %s\n", n, k, strconv.FormatFloat(s[k], 'g', -1, 64))
+			}
+		}
+	}
+}
+
+func (r *promRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.write(w)
+}
+
+//---------------------------------------------------------------------------------
+// observeCall()  --  Record how long an aXAPI ("axapi") or Kubernetes ("k8s") call took, and if it failed.
+// Good calls also count towards /readyz.
+func observeCall(api string, call string, start time.Time, err error) {
+	l := promLabels("api", api, "call", call)
+	prom.add("a10_autoscaler_api_call_duration_seconds", l+"|sum", time.Since(start).Seconds())
+	prom.add("a10_autoscaler_api_call_duration_seconds", l+"|count", 1)
+	if err != nil {
+		prom.add("a10_autoscaler_api_errors_total", l, 1)
+	}
+	health.called(api, err)
+	if b, ok := breakers[api]; ok {
+		b.called(err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPromLabels(t *testing.T) {
+	tests := []struct {
+		kv   []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"target", "web"}, `target="web"`},
+		{[]string{"target", "web", "metric", "curr_conn"}, `target="web",metric="curr_conn"`},
+		{[]string{"target", "a\"b\\c\nd"}, `target="a\"b\\c\nd"`},
+		{[]string{"target"}, ""}, // No value
+	}
+	for _, tt := range tests {
+		if got := promLabels(tt.kv...); got != tt.want {
+			t.Errorf("promLabels(%q) = %s, want %s", tt.kv, got, tt.want)
+		}
+	}
+}
+
+func TestPromWrite(t *testing.T) {
+	r := &promRegistry{series: make(map[string]map[string]float64)}
+	r.set("a10_autoscaler_current_replicas", promLabels("target", "web"), 3)
+	r.set("a10_autoscaler_current_replicas", promLabels("target", "web"), 4)
+	r.set("a10_autoscaler_current_replicas", promLabels("target", "web2"), 2)
+	r.add("a10_autoscaler_scaling_actions_total", promLabels("target", "web", "direction", "up"), 1)
+	r.add("a10_autoscaler_scaling_actions_total", promLabels("target", "web", "direction", "up"), 1)
+	r.add("a10_autoscaler_api_call_duration_seconds", promLabels("api", "k8s", "call", "X")+"|sum", 0.25)
+	r.add("a10_autoscaler_api_call_duration_seconds", promLabels("api", "k8s", "call", "X")+"|sum", 0.5)
+	r.add("a10_autoscaler_api_call_duration_seconds", promLabels("api", "k8s", "call", "X")+"|count", 2)
+
+	var b bytes.Buffer
+	r.write(&b)
+	out := b.String()
+	for _, want := range []string{
+		"# HELP a10_autoscaler_current_replicas Replicas the Deployment has.\n# TYPE a10_autoscaler_current_replicas gauge\n",
+		"a10_autoscaler_current_replicas{target=\"web\"} 4\na10_autoscaler_current_replicas{target=\"web2\"} 2\n",
+		"a10_autoscaler_scaling_actions_total{target=\"web\",direction=\"up\"} 2\n",
+		"# TYPE a10_autoscaler_api_call_duration_seconds summary\n",
+		"a10_autoscaler_api_call_duration_seconds_count{api=\"k8s\",call=\"X\"} 2\n",
+		"a10_autoscaler_api_call_duration_seconds_sum{api=\"k8s\",call=\"X\"} 0.75\n",
+		"# TYPE a10_autoscaler_api_errors_total counter\n", // Families with no series still get HELP & TYPE
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("write() output is missing %q:\n%s", want, out)
+		}
+	}
+
+	r.forget("web")
+	b.Reset()
+	r.write(&b)
+	out = b.String()
+	if strings.Contains(out, `target="web"`) {
+		t.Errorf("forget(web) left series behind:\n%s", out)
+	}
+	if !strings.Contains(out, `a10_autoscaler_current_replicas{target="web2"} 2`) {
+		t.Errorf("forget(web) removed the web2 series:\n%s", out)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+//
+//  rates.go
+//   Rates from counters. The rate figures in the Port stats (throughput-bits-per-sec, curr_conn_rate,
+//   curr_req_rate, curr_resp_rate) are coarse instantaneous values on ACOS. With 'rate_source: counters'
+//   a Target keeps the previous Port stats instead, and works the rates out from how much the totals
+//   (total_fwd_bytes + total_rev_bytes, total_conn, total_req, total_resp) went up over the time that
+//   actually passed between the two samples. A counter that goes down means the Thunder rebooted or
+//   its stats were cleared; that pass falls back on the instantaneous figures and starts over.
+//
+import (
+	"errors"
+	"math"
+	"time"
+
+	"a10/axapi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A previous sample older than this many check intervals is too old to take a rate over.
+const maxCounterIntervals = 3
+
+// checkRateSource()  --  Make sure the 'rate_source' setting is one we know.
+func checkRateSource(rs string) error {
+	switch rs {
+	case "", "gauges", "counters":
+		return nil
+	}
+	return errors.New("unknown rate_source '" + rs + "', must be gauges or counters")
+}
+
+//---------------------------------------------------------------------------------
+// portRates()  --  The Port stats with the rates the Target's 'rate_source' says to use.
+func (t *Target) portRates(ps axapi.PortStats, now time.Time, interval time.Duration, lg *log.Entry) axapi.PortStats {
+	if t.Cfg.Rate_Source == "counters" {
+		return t.counterRates(ps, now, interval, lg)
+	}
+	return ps
+}
+
+//---------------------------------------------------------------------------------
+// counterRates()  --  Replace the instantaneous rates in 'ps' with ones worked out from the counters
+// since the Target's previous sample, and keep 'ps' as the previous sample for next time.
+func (t *Target) counterRates(ps axapi.PortStats, now time.Time, interval time.Duration, lg *log.Entry) axapi.PortStats {
+	prev, prevAt := t.prevStats, t.prevAt
+	t.prevStats, t.prevAt = ps, now
+	secs := now.Sub(prevAt).Seconds()
+	switch {
+	case prevAt.IsZero():
+		lg.Debug("First sample, using instantaneous rates until the next one")
+		return ps
+	case secs <= 0 || secs > (interval*maxCounterIntervals*time.Second).Seconds():
+		lg.Debug("Previous sample is too old, using instantaneous rates")
+		return ps
+	case ps.TotalFwdBytes < prev.TotalFwdBytes || ps.TotalRevBytes < prev.TotalRevBytes ||
+		ps.TotalConn < prev.TotalConn || ps.TotalReq < prev.TotalReq || ps.TotalResp < prev.TotalResp:
+		lg.Info("Port stats counters went down (Thunder reboot or stats cleared), using instantaneous rates")
+		return ps
+	}
+	rate := func(cur uint64, old uint64) uint64 {
+		return uint64(math.Round(float64(cur-old) / secs))
+	}
+	ps.Throughput = rate(8*(ps.TotalFwdBytes+ps.TotalRevBytes), 8*(prev.TotalFwdBytes+prev.TotalRevBytes)) // bps
+	ps.CurrConnRate = rate(ps.TotalConn, prev.TotalConn)
+	ps.CurrReqRate = rate(ps.TotalReq, prev.TotalReq)
+	ps.CurrRespRate = rate(ps.TotalResp, prev.TotalResp)
+	return ps
+}
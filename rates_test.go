@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"a10/axapi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestCounterRates(t *testing.T) {
+	lg := log.WithField("test", "rates")
+	t0 := time.Unix(1700000000, 0)
+	ps := func(bytes, conn uint64, gauge uint64) axapi.PortStats {
+		return axapi.PortStats{
+			TotalFwdBytes: bytes, TotalRevBytes: bytes,
+			TotalConn: conn, TotalReq: conn, TotalResp: conn,
+			Throughput: gauge, CurrConnRate: gauge, CurrReqRate: gauge, CurrRespRate: gauge,
+		}
+	}
+	tests := []struct {
+		name      string
+		after     int // Seconds after the previous sample
+		ps        axapi.PortStats
+		wantTput  uint64
+		wantConns uint64
+	}{
+		{"first sample uses gauges", 0, ps(1000, 100, 7), 7, 7},
+		{"rate from counters", 10, ps(2000, 200, 7), 1600, 10}, // (1000+1000)*8/10 bps
+		{"uneven interval", 15, ps(3500, 500, 7), 1600, 20},
+		{"counter reset uses gauges", 10, ps(10, 5, 7), 7, 7},
+		{"after a reset", 10, ps(1010, 105, 7), 1600, 10},
+		{"stale sample uses gauges", 31, ps(2010, 205, 7), 7, 7},
+		{"within limit", 30, ps(5010, 505, 7), 1600, 10},
+	}
+	tg := &Target{}
+	now := t0
+	for _, tt := range tests {
+		now = now.Add(time.Duration(tt.after) * time.Second)
+		got := tg.counterRates(tt.ps, now, 10, lg)
+		if got.Throughput != tt.wantTput || got.CurrConnRate != tt.wantConns || got.CurrReqRate != tt.wantConns || got.CurrRespRate != tt.wantConns {
+			t.Errorf("%s: throughput %d, conn/req/resp rates %d/%d/%d, want %d, %d",
+				tt.name, got.Throughput, got.CurrConnRate, got.CurrReqRate, got.CurrRespRate, tt.wantTput, tt.wantConns)
+		}
+	}
+}
+
+func TestCheckRateSource(t *testing.T) {
+	for _, tt := range []struct {
+		rs string
+		ok bool
+	}{{"", true}, {"gauges", true}, {"counters", true}, {"Counters", false}, {"bogus", false}} {
+		if err := checkRateSource(tt.rs); (err == nil) != tt.ok {
+			t.Errorf("checkRateSource(%q) = %v", tt.rs, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+//
+//  record.go
+//   Record the full Port stats of Virtual Server Ports to a gzipped JSON lines file, for use with the
+//   'simulate' command. Only the Thunder is used; the Thunder credentials come from the command line
+//   and environment instead of a Kubernetes Secret, so the config file needs no 'cluster' section.
+//     THUNDER_PASSWORD=... a10-autoscaler-k8s record -config ./config.yaml -user admin -out stats.jsonl.gz
+//
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"a10/axapi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//---------------------------------------------------------------------------------
+// cmdRecord()  --  Poll the Port stats of each VIP every interval and write them out until stopped.
+func cmdRecord(args []string) int {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	fn := fs.String("config", "./config.yaml", "Configuration File Path (for the Thunder address & VIPs)")
+	out := fs.String("out", "", "File to write the gzipped stats to")
+	user := fs.String("user", os.Getenv("THUNDER_USER"), "Thunder username (the password is read from $THUNDER_PASSWORD)")
+	vips := fs.String("vip", "", "VIP ports to record instead of the configured Targets, ie. \"vs1/80+http,vs2/443+https\"")
+	interval := fs.Int("interval", 0, "Seconds between samples (default: check_interval)")
+	duration := fs.Int("duration", 0, "Seconds to record for (default: until interrupted)")
+	fs.Parse(args)
+	if *out == "" || *user == "" {
+		fmt.Fprintln(os.Stderr, "record needs -out and -user")
+		return 2
+	}
+
+	raw, err := ioutil.ReadFile(*fn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	cfg, errs := validateThunderConfig(raw)
+	if len(errs) > 0 {
+		fmt.Fprintln(os.Stderr, configErrors(errs).Error())
+		return 2
+	}
+	step := cfg.Interval * time.Second
+	if *interval > 0 {
+		step = time.Duration(*interval) * time.Second
+	}
+	//
+	// The VIP ports to record
+	type vipPort struct{ vip, port string }
+	var vps []vipPort
+	if *vips != "" {
+		for _, v := range strings.Split(*vips, ",") {
+			i := strings.Index(v, "/")
+			if i < 1 || !slbPortRE.MatchString(v[i+1:]) {
+				fmt.Fprintln(os.Stderr, "-vip '"+v+"' is not in <vip>/<port>+<protocol> format")
+				return 2
+			}
+			vps = append(vps, vipPort{v[:i], v[i+1:]})
+		}
+	} else {
+		seen := make(map[vipPort]bool)
+		for _, tc := range cfg.targetConfigs() {
+			vp := vipPort{tc.SLB, tc.SLB_Port}
+			if !seen[vp] {
+				seen[vp] = true
+				vps = append(vps, vp)
+			}
+		}
+	}
+	if len(vps) == 0 {
+		fmt.Fprintln(os.Stderr, "No VIPs to record; set -vip or configure some targets")
+		return 2
+	}
+
+	d := axapi.Device{}
+	d.Address = cfg.Thunder.IP + ":" + strconv.Itoa(cfg.Thunder.Port)
+	d.Username = *user
+	d.Password = os.Getenv("THUNDER_PASSWORD")
+	d.Retry = cfg.Retry.axapiRetry()
+	cctx, cancel := callCtx(context.Background(), cfg)
+	d, err = d.LoginCtx(cctx)
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Thunder login failed: "+err.Error())
+		return 1
+	}
+	defer func() {
+		cctx, cancel := callCtx(context.Background(), cfg)
+		d.LogoffCtx(cctx)
+		cancel()
+	}()
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	defer gz.Close() // Writes the gzip trailer, so the file must not be cut off without it
+	enc := json.NewEncoder(gz)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	var end <-chan time.Time
+	if *duration > 0 {
+		end = time.After(time.Duration(*duration) * time.Second)
+	}
+	log.Info("Recording " + strconv.Itoa(len(vps)) + " VIP port(s) every " + step.String() + " to '" + *out + "'")
+
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	n := 0
+	for {
+		now := time.Now()
+		for _, vp := range vps {
+			cctx, cancel := callCtx(context.Background(), cfg)
+			ps, err := d.GetVSPortStatsCtx(cctx, vp.vip, vp.port)
+			cancel()
+			if err != nil {
+				log.Error("Getting stats of '" + vp.vip + "' port " + vp.port + ": " + err.Error())
+				continue
+			}
+			if err := enc.Encode(statsRecord{Time: now.UTC(), VIP: vp.vip, Port: vp.port, Stats: ps}); err != nil {
+				log.Error("Writing '" + *out + "': " + err.Error())
+				return 1
+			}
+			n++
+		}
+		gz.Flush() // Keep what we have so far readable
+		select {
+		case <-ticker.C:
+		case <-end:
+			log.Info("Recorded " + strconv.Itoa(n) + " samples")
+			return 0
+		case <-stop:
+			log.Info("Recorded " + strconv.Itoa(n) + " samples")
+			return 0
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+//
+//  reload.go
+//   Hot reload of the config file. The file is checked for changes every few seconds (a ConfigMap mount
+//   is updated in place by Kubernetes), and a SIGHUP forces a reload. The new config must pass the same
+//   checks as at startup; if it does not, the current config stays in use.
+//   Only the scaling settings are reloaded. Changing the Cluster or Thunder connection, HTTP listen or
+//   Leader Election settings still needs a restart.
+//
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const configPoll = 10 * time.Second
+
+//---------------------------------------------------------------------------------
+// loadConfig()  --  Read the config file and apply the command line overrides.
+func loadConfig(fn string) (Configuration, error) {
+	c, err := getYamlConfig(fn)
+	if err != nil {
+		return c, err
+	}
+	//
+	//  command line overrides config file setting for Debug Level.
+	if DEBUG != 0 {
+		c.Debug = DEBUG
+	}
+	if DRY_RUN {
+		c.Dry_Run = true
+	}
+	return c, nil
+}
+
+//---------------------------------------------------------------------------------
+// watchConfig()  --  Signal on 'reload' when the config file changes or a SIGHUP comes in.
+func watchConfig(fn string, reload chan<- struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	last, _ := ioutil.ReadFile(fn)
+	ticker := time.NewTicker(configPoll)
+	for {
+		select {
+		case <-hup:
+			log.Info("SIGHUP received, reloading config file")
+		case <-ticker.C:
+			b, err := ioutil.ReadFile(fn)
+			if err != nil || bytes.Equal(b, last) {
+				continue
+			}
+			last = b
+			log.Info("Config file '" + fn + "' changed, reloading")
+		}
+		select {
+		case reload <- struct{}{}:
+		default: // A reload is already waiting
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------
+// reloadConfig()  --  Load & check the config file, and build the new list of Targets. Targets
+// with the same name as a running one keep their history, cooldown and drain state.
+func reloadConfig(fn string, old Configuration, oldTargets []*Target) (Configuration, []*Target, error) {
+	cfg, err := loadConfig(fn)
+	if err != nil {
+		return old, oldTargets, err
+	}
+	targets, err := newTargets(cfg)
+	if err != nil {
+		return old, oldTargets, err
+	}
+	if cfg.Cluster.IP != old.Cluster.IP || cfg.Cluster.Port != old.Cluster.Port || cfg.Cluster.Auth_Token != old.Cluster.Auth_Token ||
+		cfg.Thunder.IP != old.Thunder.IP || cfg.Thunder.Port != old.Thunder.Port ||
+		cfg.Thunder.Secret != old.Thunder.Secret || cfg.Thunder.Secret_NS != old.Thunder.Secret_NS ||
+		cfg.HTTP.Listen != old.HTTP.Listen || cfg.Leader != old.Leader {
+		log.Warn("Cluster/Thunder connection, HTTP listen or Leader Election settings changed; they will not be used until a restart")
+	}
+	// Keep running with the ones in use: the connections, listener and Lease loop were set up with them
+	cfg.Cluster.IP, cfg.Cluster.Port, cfg.Cluster.Auth_Token = old.Cluster.IP, old.Cluster.Port, old.Cluster.Auth_Token
+	cfg.Thunder.IP, cfg.Thunder.Port = old.Thunder.IP, old.Thunder.Port
+	cfg.Thunder.Secret, cfg.Thunder.Secret_NS = old.Thunder.Secret, old.Thunder.Secret_NS
+	cfg.HTTP.Listen = old.HTTP.Listen
+	cfg.Leader = old.Leader
+
+	byName := make(map[string]*Target)
+	for _, t := range oldTargets {
+		byName[t.Cfg.Name] = t
+	}
+	kept := make(map[string]bool)
+	for i, t := range targets {
+		o, ok := byName[t.Cfg.Name]
+		if !ok {
+			continue
+		}
+		kept[o.Cfg.Name] = true
+		// Keep the running Target, with the new settings
+		o.update(t)
+		targets[i] = o
+	}
+	for n := range byName {
+		if !kept[n] {
+			prom.forget(n)
+		}
+	}
+	return cfg, targets, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadConfig(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(s string) {
+		if err := ioutil.WriteFile(fn, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(testConfig)
+	cfg, err := loadConfig(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := newTargets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := targets[0]
+	web.st.lastScale = time.Unix(1700000000, 0)
+	prom.set("a10_autoscaler_current_replicas", promLabels("target", "web"), 4)
+
+	// New rate, a second Target, and a Cluster address that needs a restart
+	s := strings.Replace(testConfig, "    rate: 20\n", "    rate: 40\n", 1)
+	s = strings.Replace(s, "ip: 10.1.1.220", "ip: 10.9.9.9", 1)
+	s += "  - name: api\n    slb: api-vip\n    slb_port: \"443+https\"\n    deployment: api\n    namespace: cyan\n    min_pods: 1\n    max_pods: 4\n    rate: 10\n"
+	write(s)
+	cfg2, targets2, err := reloadConfig(fn, cfg, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets2) != 2 {
+		t.Fatalf("%d Targets after reload, want 2", len(targets2))
+	}
+	if targets2[0] != web || web.st.lastScale.IsZero() {
+		t.Error("the running 'web' Target was replaced, want it kept with its state")
+	}
+	if web.Cfg.Rate != 40 {
+		t.Errorf("web rate = %d after reload, want 40", web.Cfg.Rate)
+	}
+	if cfg2.Cluster.IP != "10.1.1.220" {
+		t.Errorf("cluster.ip = %s after reload, want the one in use kept", cfg2.Cluster.IP)
+	}
+
+	// A bad file keeps what is running
+	write(s + "bogus: [\n")
+	cfg3, targets3, err := reloadConfig(fn, cfg2, targets2)
+	if err == nil {
+		t.Error("reload of a bad config file worked, want an error")
+	}
+	if len(targets3) != 2 || targets3[0] != web || cfg3.Cluster.IP != cfg2.Cluster.IP {
+		t.Error("reload of a bad config file did not keep the running config")
+	}
+
+	// Removing a Target drops its metrics
+	write(strings.Replace(s, "name: web\n", "name: web3\n", 1))
+	_, targets4, err := reloadConfig(fn, cfg2, targets2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets4[0] == web {
+		t.Error("renamed Target kept the old one")
+	}
+	var b bytes.Buffer
+	prom.write(&b)
+	if strings.Contains(b.String(), `target="web"`) {
+		t.Error("removed Target still has metrics")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+//
+//  schedule.go
+//   Scheduled overrides of a Target's min_pods/max_pods. Each schedule starts at the times given by a
+//   standard 5 field cron expression (minute hour day-of-month month day-of-week) in its timezone, and
+//   stays in effect for 'duration' seconds. When more than one schedule is active, the later one in the
+//   list wins for the bounds it sets.
+//
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // The container may not have a zoneinfo database
+)
+
+// ScheduleConfig is one entry of a Target's 'schedules' list. A zero min_pods or max_pods
+// leaves that bound alone.
+type ScheduleConfig struct {
+	Name     string        `yaml:"name"`
+	Cron     string        `yaml:"cron"`
+	Timezone string        `yaml:"timezone"`
+	Duration time.Duration `yaml:"duration"`
+	Min_Pods int           `yaml:"min_pods"`
+	Max_Pods int           `yaml:"max_pods"`
+}
+
+// schedule is a parsed ScheduleConfig.
+type schedule struct {
+	cfg ScheduleConfig
+	loc *time.Location
+	// Allowed values for each cron field
+	minute, hour, dom, month, dow [64]bool
+	domStar, dowStar              bool
+}
+
+//---------------------------------------------------------------------------------
+// newSchedule()  --  Parse the cron expression & timezone of a schedule.
+func newSchedule(sc ScheduleConfig) (*schedule, error) {
+	s := &schedule{cfg: sc, loc: time.UTC}
+	if sc.Name == "" {
+		s.cfg.Name = sc.Cron
+	}
+	if sc.Timezone != "" {
+		loc, err := time.LoadLocation(sc.Timezone)
+		if err != nil {
+			return nil, errors.New("schedule '" + s.cfg.Name + "': " + err.Error())
+		}
+		s.loc = loc
+	}
+	if sc.Duration <= 0 {
+		return nil, errors.New("schedule '" + s.cfg.Name + "' needs a 'duration' greater than zero")
+	}
+	if sc.Min_Pods < 0 || sc.Max_Pods < 0 || (sc.Max_Pods > 0 && sc.Min_Pods > sc.Max_Pods) {
+		return nil, errors.New("schedule '" + s.cfg.Name + "' has invalid min_pods/max_pods")
+	}
+
+	f := strings.Fields(sc.Cron)
+	if len(f) != 5 {
+		return nil, errors.New("schedule '" + s.cfg.Name + "': cron expression needs 5 fields, got " + strconv.Itoa(len(f)))
+	}
+	var err error
+	for i, x := range []struct {
+		set      *[64]bool
+		min, max int
+	}{{&s.minute, 0, 59}, {&s.hour, 0, 23}, {&s.dom, 1, 31}, {&s.month, 1, 12}, {&s.dow, 0, 7}} {
+		if err = parseCronField(f[i], x.min, x.max, x.set); err != nil {
+			return nil, errors.New("schedule '" + s.cfg.Name + "': cron field " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+	}
+	if s.dow[7] { // Sunday can be 0 or 7
+		s.dow[0] = true
+	}
+	// As in cron, a day field starting with '*' (ie. '*/2') counts as unrestricted in fires()
+	s.domStar = strings.HasPrefix(f[2], "*")
+	s.dowStar = strings.HasPrefix(f[4], "*")
+	return s, nil
+}
+
+// parseCronField()  --  Handles '*', 'n', 'a-b', lists of those, and '/step' on any of them.
+func parseCronField(f string, min int, max int, set *[64]bool) error {
+	for _, part := range strings.Split(f, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return errors.New("bad step in '" + part + "'")
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			if i := strings.Index(part, "-"); i >= 0 {
+				a, err1 := strconv.Atoi(part[:i])
+				b, err2 := strconv.Atoi(part[i+1:])
+				if err1 != nil || err2 != nil {
+					return errors.New("bad range '" + part + "'")
+				}
+				lo, hi = a, b
+			} else {
+				n, err := strconv.Atoi(part)
+				if err != nil {
+					return errors.New("bad value '" + part + "'")
+				}
+				lo, hi = n, n
+				if step > 1 {
+					hi = max
+				}
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return errors.New("'" + part + "' out of range " + strconv.Itoa(min) + "-" + strconv.Itoa(max))
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
+
+// fires()  --  True if the cron expression matches the given minute.
+func (s *schedule) fires(t time.Time) bool {
+	if !s.minute[t.Minute()] || !s.hour[t.Hour()] || !s.month[int(t.Month())] {
+		return false
+	}
+	// Same as cron: if both day fields are restricted, either one matching is enough; otherwise both must.
+	d, w := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.domStar || s.dowStar {
+		return d && w
+	}
+	return d || w
+}
+
+//---------------------------------------------------------------------------------
+// active()  --  True if the schedule started within the last 'duration' seconds.
+func (s *schedule) active(now time.Time) bool {
+	t := now.In(s.loc).Truncate(time.Minute)
+	start := now.Add(-s.cfg.Duration * time.Second)
+	for ; t.After(start); t = t.Add(-time.Minute) {
+		if s.fires(t) {
+			return true
+		}
+	}
+	return false
+}
+
+//---------------------------------------------------------------------------------
+// bounds()  --  Work out the min/max Pods in effect right now, and the names of the active schedules.
+func bounds(scheds []*schedule, min int, max int, now time.Time) (int, int, []string) {
+	var names []string
+	for _, s := range scheds {
+		if !s.active(now) {
+			continue
+		}
+		names = append(names, s.cfg.Name)
+		if s.cfg.Min_Pods > 0 {
+			min = s.cfg.Min_Pods
+		}
+		if s.cfg.Max_Pods > 0 {
+			max = s.cfg.Max_Pods
+		}
+	}
+	if max < min {
+		max = min
+	}
+	return min, max, names
+}
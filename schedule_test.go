@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int // Values that should be set; nil for an error
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}},
+		{"3", 0, 59, []int{3}},
+		{"1-4", 0, 59, []int{1, 2, 3, 4}},
+		{"1,3,5", 0, 59, []int{1, 3, 5}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"10-20/5", 0, 59, []int{10, 15, 20}},
+		{"50/5", 0, 59, []int{50, 55}}, // n/step runs from n to the end of the range
+		{"1/10", 1, 31, []int{1, 11, 21, 31}},
+		{"0-4/2,10", 0, 59, []int{0, 2, 4, 10}},
+		{"7", 0, 7, []int{7}},
+		{"60", 0, 59, nil},
+		{"0", 1, 31, nil},
+		{"5-1", 0, 59, nil},
+		{"*/0", 0, 59, nil},
+		{"*/x", 0, 59, nil},
+		{"a-3", 0, 59, nil},
+		{"mon", 0, 7, nil},
+		{"", 0, 59, nil},
+	}
+	for _, tt := range tests {
+		var set [64]bool
+		err := parseCronField(tt.field, tt.min, tt.max, &set)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseCronField(%q) = nil error, want an error", tt.field)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCronField(%q) = %v", tt.field, err)
+			continue
+		}
+		var want [64]bool
+		for _, v := range tt.want {
+			want[v] = true
+		}
+		if set != want {
+			var got []int
+			for v, ok := range set {
+				if ok {
+					got = append(got, v)
+				}
+			}
+			t.Errorf("parseCronField(%q) set %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleFires(t *testing.T) {
+	// 2024-06-01 is a Saturday, 2024-06-03 a Monday, 2024-06-15 a Saturday
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		cron string
+		at   string
+		want bool
+	}{
+		{"0 9 * * *", "2024-06-01 09:00", true},
+		{"0 9 * * *", "2024-06-01 09:01", false},
+		{"0 9 * * *", "2024-06-01 10:00", false},
+		{"*/20 * * * *", "2024-06-01 10:40", true},
+		{"*/20 * * * *", "2024-06-01 10:41", false},
+		{"0 9 * 7 *", "2024-06-01 09:00", false},
+		// Only one day field restricted: it has to match
+		{"0 9 1 * *", "2024-06-01 09:00", true},
+		{"0 9 1 * *", "2024-06-03 09:00", false},
+		{"0 9 * * 1", "2024-06-03 09:00", true},
+		{"0 9 * * 1", "2024-06-01 09:00", false},
+		// Both day fields restricted: either one matching is enough
+		{"0 9 15 * 1", "2024-06-03 09:00", true},  // Monday, not the 15th
+		{"0 9 15 * 1", "2024-06-15 09:00", true},  // 15th, not a Monday
+		{"0 9 15 * 1", "2024-06-01 09:00", false}, // Neither
+		// A day field starting with '*' is not "restricted", so both have to match
+		{"0 9 */2 * 1", "2024-06-03 09:00", true},  // Monday, odd day
+		{"0 9 */2 * 1", "2024-06-10 09:00", false}, // Monday, even day
+		{"0 9 */2 * 1", "2024-06-11 09:00", false}, // Odd day, Tuesday
+		{"0 9 1 * */2", "2024-06-01 09:00", true},  // 1st, Saturday (dow '*/2' is 0,2,4,6)
+		{"0 9 1 * */2", "2024-07-01 09:00", false}, // 1st, Monday
+		{"0 9 1 * */2", "2024-06-02 09:00", false}, // Sunday, the 2nd
+		// Sunday is 0 or 7
+		{"0 9 * * 7", "2024-06-02 09:00", true},
+		{"0 9 * * 0", "2024-06-02 09:00", true},
+		{"0 9 * * 5-7", "2024-06-02 09:00", true},
+	}
+	for _, tt := range tests {
+		s, err := newSchedule(ScheduleConfig{Cron: tt.cron, Duration: 60})
+		if err != nil {
+			t.Errorf("newSchedule(%q) = %v", tt.cron, err)
+			continue
+		}
+		if got := s.fires(at(tt.at)); got != tt.want {
+			t.Errorf("%q fires at %s = %v, want %v", tt.cron, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	s, err := newSchedule(ScheduleConfig{Cron: "0 9 * * *", Timezone: "America/New_York", Duration: 3600, Min_Pods: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		at   string // UTC; New York is UTC-4 in June
+		want bool
+	}{
+		{"2024-06-01T12:59:00Z", false},
+		{"2024-06-01T13:00:00Z", true},
+		{"2024-06-01T13:59:30Z", true},
+		{"2024-06-01T14:00:00Z", false},
+		{"2024-06-01T09:30:00Z", false},
+	}
+	for _, tt := range tests {
+		now, _ := time.Parse(time.RFC3339, tt.at)
+		if got := s.active(now); got != tt.want {
+			t.Errorf("active(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+	now, _ := time.Parse(time.RFC3339, "2024-06-01T13:30:00Z")
+	if min, max, names := bounds([]*schedule{s}, 1, 3, now); min != 5 || max != 5 || len(names) != 1 {
+		t.Errorf("bounds() = %d, %d, %v, want 5, 5, [0 9 * * *]", min, max, names)
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+//
+//  sim.go
+//   Offline simulation: replay recorded Virtual Server Port stats through the scaling code in accelerated
+//   time, against a pretend Deployment whose new Pods take a while to start. Prints the Replica timeline
+//   and a summary (Pod minutes, time over capacity) so 'rate', metrics and behavior settings can be
+//   tuned before rollout.
+//     a10-autoscaler-k8s simulate -config ./config.yaml -data stats.jsonl.gz -startup 45
+//
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8sgo"
+
+	"a10/axapi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// statsRecord is one sample of a recorded stats file: the Port stats of a Virtual Server Port at a
+// point in time. A sample without a VIP & Port is used for every Target.
+type statsRecord struct {
+	Time  time.Time       `json:"time"`
+	VIP   string          `json:"vip,omitempty"`
+	Port  string          `json:"port,omitempty"`
+	Stats axapi.PortStats `json:"stats"`
+}
+
+//---------------------------------------------------------------------------------
+// readStats()  --  Read a recorded stats file, sorted by time. The file can be gzipped, and is either
+// JSON lines of statsRecords, or CSV with a header line naming the columns: 'time' (RFC3339 or Unix
+// seconds), optional 'vip' & 'port', and Port stats by their aXAPI names, ie. "throughput-bits-per-sec".
+func readStats(fn string) ([]statsRecord, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if b, _ := br.Peek(2); len(b) == 2 && b[0] == 0x1f && b[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+		r = br
+	}
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return nil, errors.New(fn + ": no stats found")
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		br.ReadByte()
+	}
+
+	var recs []statsRecord
+	if b, _ := br.Peek(1); b[0] == '{' {
+		recs, err = readStatsJSON(r)
+	} else {
+		recs, err = readStatsCSV(r)
+	}
+	if err != nil {
+		return nil, errors.New(fn + ": " + err.Error())
+	}
+	if len(recs) == 0 {
+		return nil, errors.New(fn + ": no stats found")
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Time.Before(recs[j].Time) })
+	return recs, nil
+}
+
+func readStatsJSON(r io.Reader) ([]statsRecord, error) {
+	var recs []statsRecord
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var sr statsRecord
+		err := dec.Decode(&sr)
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err == io.ErrUnexpectedEOF && len(recs) > 0 {
+			return recs, nil // A recording that was cut off; use what made it out
+		}
+		if err != nil {
+			return nil, errors.New("record " + strconv.Itoa(n) + ": " + err.Error())
+		}
+		recs = append(recs, sr)
+	}
+}
+
+func readStatsCSV(r io.Reader) ([]statsRecord, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	head, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	var recs []statsRecord
+	for n := 2; ; n++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Build the stats as JSON, so the columns are matched to the aXAPI names of the fields
+		var sr statsRecord
+		stats := make(map[string]uint64)
+		for i, col := range head {
+			v := strings.TrimSpace(row[i])
+			switch col {
+			case "time":
+				if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+					sr.Time = time.Unix(secs, 0)
+				} else if sr.Time, err = time.Parse(time.RFC3339, v); err != nil {
+					return nil, errors.New("line " + strconv.Itoa(n) + ": bad time '" + v + "'")
+				}
+			case "vip":
+				sr.VIP = v
+			case "port":
+				sr.Port = v
+			default:
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil || f < 0 {
+					return nil, errors.New("line " + strconv.Itoa(n) + ": bad value '" + v + "' for " + col)
+				}
+				stats[col] = uint64(f)
+			}
+		}
+		b, _ := json.Marshal(stats)
+		json.Unmarshal(b, &sr.Stats)
+		recs = append(recs, sr)
+	}
+}
+
+//---------------------------------------------------------------------------------
+// simThunder hands out the recorded stats for the current simulated time.
+type simThunder struct {
+	now   time.Time
+	byKey map[string][]statsRecord // "vip|port", or "|" for samples used by every Target
+}
+
+func newSimThunder(recs []statsRecord) *simThunder {
+	st := &simThunder{byKey: make(map[string][]statsRecord)}
+	for _, sr := range recs {
+		k := sr.VIP + "|" + sr.Port
+		st.byKey[k] = append(st.byKey[k], sr)
+	}
+	return st
+}
+
+func (st *simThunder) GetVSPortStatsCtx(ctx context.Context, vs string, p string) (axapi.PortStats, error) {
+	recs, ok := st.byKey[vs+"|"+p]
+	if !ok {
+		recs = st.byKey["|"]
+	}
+	// Latest sample at or before now
+	i := sort.Search(len(recs), func(i int) bool { return recs[i].Time.After(st.now) })
+	if i == 0 {
+		return axapi.PortStats{}, errors.New("no recorded stats for '" + vs + "' port " + p + " at " + st.now.Format(time.RFC3339))
+	}
+	return recs[i-1].Stats, nil
+}
+
+var errNotSimulated = errors.New("not simulated")
+
+func (st *simThunder) GetServiceGroupsCtx(ctx context.Context) ([]axapi.SvcGrp, error) {
+	return nil, errNotSimulated
+}
+func (st *simThunder) GetSLBserversCtx(ctx context.Context) ([]axapi.Server, error) {
+	return nil, errNotSimulated
+}
+func (st *simThunder) GetMemberStatsCtx(ctx context.Context, sg string, m axapi.Member) (axapi.MemberStats, error) {
+	return axapi.MemberStats{}, errNotSimulated
+}
+func (st *simThunder) DisableMemberCtx(ctx context.Context, sg string, m axapi.Member) error {
+	return errNotSimulated
+}
+func (st *simThunder) EnableMemberCtx(ctx context.Context, sg string, m axapi.Member) error {
+	return errNotSimulated
+}
+func (st *simThunder) GetHostnameCtx(ctx context.Context) (axapi.Device, error) {
+	return axapi.Device{}, nil
+}
+
+//---------------------------------------------------------------------------------
+// simCluster is a set of pretend Deployments. Pods added by a scale up only count as ready
+// 'startup' after they were asked for; a scale down removes the newest Pods right away.
+type simCluster struct {
+	now     time.Time
+	startup time.Duration
+	deps    map[string]*simDeployment // namespace/name
+}
+
+type simDeployment struct {
+	replicas int
+	ready    []time.Time // When each Pod is ready, oldest first
+}
+
+func (sc *simCluster) add(ns string, name string, replicas int) {
+	sd := &simDeployment{replicas: replicas}
+	for i := 0; i < replicas; i++ {
+		sd.ready = append(sd.ready, sc.now)
+	}
+	sc.deps[ns+"/"+name] = sd
+}
+
+// readyPods()  --  Replicas of the Deployment that have finished starting up.
+func (sc *simCluster) readyPods(ns string, name string) int {
+	n := 0
+	for _, r := range sc.deps[ns+"/"+name].ready {
+		if !r.After(sc.now) {
+			n++
+		}
+	}
+	return n
+}
+
+func (sc *simCluster) GetDeploymentStatusCtx(ctx context.Context, dep string, ns string) (k8sgo.Deployment, error) {
+	sd, ok := sc.deps[ns+"/"+dep]
+	if !ok {
+		return k8sgo.Deployment{}, errors.New("404 Not Found")
+	}
+	return k8sgo.Deployment{Name: dep, Namespace: ns, CurrentReplicas: sd.replicas}, nil
+}
+
+func (sc *simCluster) AdjustDeploymentCtx(ctx context.Context, d k8sgo.Deployment, num int) (k8sgo.Deployment, error) {
+	sd, ok := sc.deps[d.Namespace+"/"+d.Name]
+	if !ok {
+		return d, errors.New("404 Not Found")
+	}
+	for len(sd.ready) < num {
+		sd.ready = append(sd.ready, sc.now.Add(sc.startup))
+	}
+	sd.ready = sd.ready[:num]
+	sd.replicas = num
+	d.CurrentReplicas = num
+	return d, nil
+}
+
+func (sc *simCluster) GetDeploymentPodsCtx(ctx context.Context, d k8sgo.Deployment) ([]k8sgo.Pod, error) {
+	return nil, errNotSimulated
+}
+func (sc *simCluster) SetPodDeletionCostCtx(ctx context.Context, p k8sgo.Pod, cost int) error {
+	return errNotSimulated
+}
+func (sc *simCluster) ClearPodDeletionCostCtx(ctx context.Context, p k8sgo.Pod) error {
+	return errNotSimulated
+}
+func (sc *simCluster) DeletePodCtx(ctx context.Context, p k8sgo.Pod) error     { return errNotSimulated }
+func (sc *simCluster) CreateEventCtx(ctx context.Context, e k8sgo.Event) error { return nil }
+func (sc *simCluster) ListCustomObjectsCtx(ctx context.Context, r k8sgo.CustomResource, ns string) ([]k8sgo.CustomObject, error) {
+	return nil, nil
+}
+func (sc *simCluster) PatchCustomObjectStatusCtx(ctx context.Context, r k8sgo.CustomResource, o k8sgo.CustomObject, status []byte) error {
+	return nil
+}
+
+// simSummary adds up how a Target did over the simulation.
+type simSummary struct {
+	evals       int
+	ups, downs  int
+	minRpl      int
+	maxRpl      int
+	podMinutes  float64
+	overCap     time.Duration
+	lastReplica int
+}
+
+//---------------------------------------------------------------------------------
+// cmdSimulate()  --  Run recorded stats through the scaling code, and print what would have happened.
+func cmdSimulate(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	fn := fs.String("config", "./config.yaml", "Configuration File Path")
+	data := fs.String("data", "", "Recorded stats file (JSON lines or CSV, may be gzipped)")
+	startup := fs.Int("startup", 30, "Seconds a new Pod takes to start taking traffic")
+	replicas := fs.Int("replicas", 0, "Replicas each Deployment starts with (default: its min_pods)")
+	out := fs.String("out", "", "Write the Replica timeline CSV to this file instead of stdout")
+	verbose := fs.Bool("v", false, "Show the agent's log while simulating")
+	fs.Parse(args)
+	if *data == "" {
+		fmt.Fprintln(os.Stderr, "simulate needs a -data file")
+		return 2
+	}
+
+	cfg, err := getYamlConfig(*fn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	recs, err := readStats(*data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	setupLogging(cfg)
+	if !*verbose {
+		log.SetLevel(log.ErrorLevel)
+	}
+	//
+	// Everything is done to the pretend Deployments, and with no waiting around
+	cfg.Dry_Run = false
+	cfg.CRD.Enabled = false
+	cfg.Drain.Enabled = false
+	cfg.Timeout = 0
+	for i := range cfg.Targets {
+		cfg.Targets[i].Dry_Run = false
+		cfg.Targets[i].Drain.Enabled = false
+	}
+	targets, err := newTargets(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	start, end := recs[0].Time, recs[len(recs)-1].Time
+	d := newSimThunder(recs)
+	c := &simCluster{now: start, startup: time.Duration(*startup) * time.Second, deps: make(map[string]*simDeployment)}
+	sums := make([]*simSummary, len(targets))
+	// The timeline's metrics come from the same rates as the Targets use, each from its own copy of
+	// the previous sample so the Targets' own are left alone
+	rates := make([]*Target, len(targets))
+	for i, t := range targets {
+		rates[i] = &Target{Cfg: t.Cfg}
+		n := *replicas
+		if n == 0 {
+			n = t.Cfg.Min_Pods
+		}
+		c.add(t.Cfg.Namespace, t.Cfg.Deployment, n)
+		sums[i] = &simSummary{minRpl: n, maxRpl: n, lastReplica: n}
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		w, err = os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 2
+		}
+		defer w.Close()
+	}
+	tw := csv.NewWriter(w)
+	tw.Write([]string{"time", "target", "replicas", "ready", "over_capacity", "metrics"})
+
+	step := cfg.Interval * time.Second
+	for now := start; !now.After(end); now = now.Add(step) {
+		d.now = now
+		c.now = now
+		procLoop(context.Background(), d, c, cfg, targets, now)
+
+		for i, t := range targets {
+			tc := t.Cfg
+			y, _ := c.GetDeploymentStatusCtx(context.Background(), tc.Deployment, tc.Namespace)
+			ready := c.readyPods(tc.Namespace, tc.Deployment)
+			// Over capacity if the ready Pods cannot handle any one of the load metrics
+			over := false
+			var ms []string
+			if ps, err := d.GetVSPortStatsCtx(context.Background(), tc.SLB, tc.SLB_Port); err == nil {
+				ps = rates[i].portRates(ps, now, cfg.Interval, t.logger())
+				for j, v := range metricValues(tc.Metrics, ps) {
+					mc := tc.Metrics[j]
+					ms = append(ms, mc.Type+"="+strconv.FormatFloat(v, 'f', -1, 64))
+					if !metricDefs[mc.Type].latency && v > float64(ready)*mc.Target {
+						over = true
+					}
+				}
+			}
+			tw.Write([]string{now.UTC().Format(time.RFC3339), tc.Name, strconv.Itoa(y.CurrentReplicas), strconv.Itoa(ready), strconv.FormatBool(over), strings.Join(ms, " ")})
+
+			s := sums[i]
+			s.evals++
+			if y.CurrentReplicas > s.lastReplica {
+				s.ups++
+			} else if y.CurrentReplicas < s.lastReplica {
+				s.downs++
+			}
+			s.lastReplica = y.CurrentReplicas
+			if y.CurrentReplicas < s.minRpl {
+				s.minRpl = y.CurrentReplicas
+			}
+			if y.CurrentReplicas > s.maxRpl {
+				s.maxRpl = y.CurrentReplicas
+			}
+			s.podMinutes += float64(y.CurrentReplicas) * step.Minutes()
+			if over {
+				s.overCap += step
+			}
+		}
+	}
+	tw.Flush()
+
+	//
+	// Summary goes to stderr, to keep the timeline on stdout clean
+	span := end.Sub(start) + step
+	fmt.Fprintln(os.Stderr, "Simulated "+span.String()+" ("+strconv.Itoa(len(recs))+" samples) from "+start.UTC().Format(time.RFC3339))
+	for i, t := range targets {
+		s := sums[i]
+		pct := 100 * s.overCap.Seconds() / span.Seconds()
+		fmt.Fprintf(os.Stderr, "%s: %d evaluations, %d scale ups, %d scale downs, %d-%d Replicas, %.1f Pod minutes, over capacity %s (%.1f%%)\n",
+			t.Cfg.Name, s.evals, s.ups, s.downs, s.minRpl, s.maxRpl, s.podMinutes, s.overCap.String(), pct)
+	}
+	return 0
+}
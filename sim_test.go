@@ -0,0 +1,188 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadStats(t *testing.T) {
+	gz := func(s string) string {
+		var b strings.Builder
+		w := gzip.NewWriter(&b)
+		w.Write([]byte(s))
+		w.Close()
+		return b.String()
+	}
+	const jsonl = `{"time":"2024-01-01T00:00:10Z","vip":"ws-vip","port":"80+http","stats":{"curr_conn":7}}
+{"time":"2024-01-01T00:00:00Z","vip":"ws-vip","port":"80+http","stats":{"curr_conn":5}}
+`
+	tests := []struct {
+		name  string
+		data  string
+		conns []uint64 // curr_conn of each record, in time order
+		err   string
+	}{
+		{"JSON lines, sorted by time", jsonl, []uint64{5, 7}, ""},
+		{"gzipped", gz(jsonl), []uint64{5, 7}, ""},
+		{"cut off", jsonl + `{"time":"2024-01-01T00:00:20Z","st`, []uint64{5, 7}, ""},
+		{"CSV with unix times", "time,curr_conn\n1704067200,3\n1704067210,4\n", []uint64{3, 4}, ""},
+		{"CSV with RFC3339 times", "\n time, vip, port, curr_conn\n2024-01-01T00:00:00Z, ws-vip, 80+http, 9\n", []uint64{9}, ""},
+		{"CSV bad value", "time,curr_conn\n1704067200,lots\n", nil, "line 2: bad value 'lots' for curr_conn"},
+		{"CSV bad time", "time,curr_conn\nyesterday,1\n", nil, "line 2: bad time 'yesterday'"},
+		{"JSON bad record", `{"time":1}`, nil, "record 1: "},
+		{"empty", "  \n", nil, "no stats found"},
+		{"header only", "time,curr_conn\n", nil, "no stats found"},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		fn := filepath.Join(dir, strconv.Itoa(i))
+		if err := ioutil.WriteFile(fn, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		recs, err := readStats(fn)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var conns []uint64
+		for _, r := range recs {
+			conns = append(conns, r.Stats.CurrConn)
+		}
+		if len(conns) != len(tt.conns) {
+			t.Errorf("%s: curr_conn = %v, want %v", tt.name, conns, tt.conns)
+			continue
+		}
+		for j := range conns {
+			if conns[j] != tt.conns[j] {
+				t.Errorf("%s: curr_conn = %v, want %v", tt.name, conns, tt.conns)
+				break
+			}
+		}
+	}
+}
+
+// simTimeline()  --  Run the simulate subcommand and return the timeline it writes, without the header.
+func simTimeline(t *testing.T, config string, data string, args ...string) [][]string {
+	dir := t.TempDir()
+	cfn, dfn, out := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "stats.csv"), filepath.Join(dir, "out.csv")
+	ioutil.WriteFile(cfn, []byte(config), 0644)
+	ioutil.WriteFile(dfn, []byte(data), 0644)
+	// Keep the summary out of the test output
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	rc := cmdSimulate(append([]string{"-config", cfn, "-data", dfn, "-out", out}, args...))
+	os.Stderr = stderr
+	if rc != 0 {
+		t.Fatalf("simulate returned %d", rc)
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) < 2 || strings.Join(rows[0], ",") != "time,target,replicas,ready,over_capacity,metrics" {
+		t.Fatalf("timeline = %v", rows)
+	}
+	return rows[1:]
+}
+
+func TestSimulate(t *testing.T) {
+	config := strings.Replace(testConfig, "    rate: 20\n", "    metrics:\n      - type: curr_conn\n        target: 100\n", 1)
+	// 100 connections for a minute, then 450
+	var b strings.Builder
+	b.WriteString("time,curr_conn\n")
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= 12; i++ {
+		conns := 100
+		if i >= 6 {
+			conns = 450
+		}
+		b.WriteString(strconv.FormatInt(t0.Add(time.Duration(i)*10*time.Second).Unix(), 10) + "," + strconv.Itoa(conns) + "\n")
+	}
+
+	rows := simTimeline(t, config, b.String(), "-startup", "20")
+	if len(rows) != 13 {
+		t.Fatalf("%d timeline rows, want 13", len(rows))
+	}
+	// time, target, replicas, ready, over_capacity, metrics
+	tests := []struct {
+		row             int
+		replicas, ready string
+		over            string
+		metrics         string
+	}{
+		{0, "1", "1", "false", "curr_conn=100"},
+		{5, "1", "1", "false", "curr_conn=100"},
+		{6, "5", "1", "true", "curr_conn=450"}, // Scaled, but the new Pods are starting
+		{7, "5", "1", "true", "curr_conn=450"},
+		{8, "5", "5", "false", "curr_conn=450"},
+		{12, "5", "5", "false", "curr_conn=450"},
+	}
+	for _, tt := range tests {
+		r := rows[tt.row]
+		if r[1] != "web" || r[2] != tt.replicas || r[3] != tt.ready || r[4] != tt.over || r[5] != tt.metrics {
+			t.Errorf("row %d = %v, want replicas %s, ready %s, over_capacity %s, %s", tt.row, r, tt.replicas, tt.ready, tt.over, tt.metrics)
+		}
+	}
+
+	// Starting Replicas from the command line: no wait for Pods to start
+	rows = simTimeline(t, config, "time,curr_conn\n1704067200,450\n", "-replicas", "5")
+	if r := rows[0]; r[2] != "5" || r[3] != "5" || r[4] != "false" {
+		t.Errorf("-replicas 5: first row = %v, want 5 ready", r)
+	}
+}
+
+func TestSimulateCounters(t *testing.T) {
+	config := strings.Replace(testConfig, "    rate: 20\n",
+		"    rate_source: counters\n    metrics:\n      - type: curr_conn_rate\n        target: 10\n", 1)
+	// 10 new connections a second for 50s, then 40. The Thunder's own rate figure stays at 1.
+	var b strings.Builder
+	b.WriteString("time,total_conn,curr_conn_rate\n")
+	total := 1000
+	for i := 0; i <= 8; i++ {
+		if i > 0 && i <= 4 {
+			total += 100
+		} else if i > 4 {
+			total += 400
+		}
+		b.WriteString(strconv.Itoa(1704067200+i*10) + "," + strconv.Itoa(total) + ",1\n")
+	}
+
+	rows := simTimeline(t, config, b.String(), "-startup", "20")
+	// time, target, replicas, ready, over_capacity, metrics
+	tests := []struct {
+		row             int
+		replicas, ready string
+		over            string
+		metrics         string
+	}{
+		{0, "1", "1", "false", "curr_conn_rate=1"}, // No previous sample yet
+		{1, "1", "1", "false", "curr_conn_rate=10"},
+		{4, "1", "1", "false", "curr_conn_rate=10"},
+		{5, "4", "1", "true", "curr_conn_rate=40"},
+		{7, "4", "4", "false", "curr_conn_rate=40"},
+	}
+	for _, tt := range tests {
+		r := rows[tt.row]
+		if r[2] != tt.replicas || r[3] != tt.ready || r[4] != tt.over || r[5] != tt.metrics {
+			t.Errorf("row %d = %v, want replicas %s, ready %s, over_capacity %s, %s", tt.row, r, tt.replicas, tt.ready, tt.over, tt.metrics)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+//
+//  smoothing.go
+//   Input smoothing for a Target's metrics. Where the stabilization windows smooth out the Replicas
+//   the policy asks for, these smooth out the metric values going in to it, one metric at a time:
+//    ewma        -- exponentially weighted moving average; a sample's weight halves every 'half_life'
+//    sma         -- plain average of the samples over the last 'window'
+//    percentile  -- 'percentile'th value of the samples over the last 'window', ie. p95
+//   The raw and smoothed values both show up in the metrics and the audit log.
+//
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// SmoothConfig is the 'smoothing' section of a metric. Times are in seconds.
+type SmoothConfig struct {
+	Method     string        `yaml:"method" json:"method"`         // ewma, sma or percentile; blank for none
+	Half_Life  time.Duration `yaml:"half_life" json:"halfLife"`    // ewma
+	Window     time.Duration `yaml:"window" json:"window"`         // sma & percentile
+	Percentile float64       `yaml:"percentile" json:"percentile"` // percentile, 0-100 (default 95)
+}
+
+const defaultPercentile = 95
+
+// checkSmoothing()  --  Make sure the smoothing settings of a metric make sense.
+func checkSmoothing(sc SmoothConfig) error {
+	switch sc.Method {
+	case "":
+	case "ewma":
+		if sc.Half_Life <= 0 {
+			return errors.New("ewma smoothing needs a 'half_life' greater than zero")
+		}
+	case "sma", "percentile":
+		if sc.Window <= 0 {
+			return errors.New(sc.Method + " smoothing needs a 'window' greater than zero")
+		}
+		if sc.Percentile < 0 || sc.Percentile > 100 {
+			return errors.New("percentile must be 0-100")
+		}
+	default:
+		return errors.New("unknown smoothing method '" + sc.Method + "', must be ewma, sma or percentile")
+	}
+	return nil
+}
+
+type point struct {
+	at time.Time
+	v  float64
+}
+
+// smoother keeps what one metric of a Target needs to smooth its values.
+type smoother struct {
+	cfg     SmoothConfig
+	avg     float64 // ewma
+	last    time.Time
+	samples []point // sma & percentile, oldest first
+}
+
+//---------------------------------------------------------------------------------
+// add()  --  Add the value sampled at 'now' and return the smoothed value.
+func (s *smoother) add(now time.Time, v float64) float64 {
+	switch s.cfg.Method {
+	case "ewma":
+		if s.last.IsZero() {
+			s.avg = v
+		} else {
+			a := 1 - math.Exp2(-now.Sub(s.last).Seconds()/(s.cfg.Half_Life*time.Second).Seconds())
+			s.avg += a * (v - s.avg)
+		}
+		s.last = now
+		return s.avg
+	case "sma", "percentile":
+		s.samples = append(s.samples, point{now, v})
+		from := now.Add(-s.cfg.Window * time.Second)
+		i := 0
+		for i < len(s.samples)-1 && !s.samples[i].at.After(from) {
+			i++
+		}
+		s.samples = s.samples[i:]
+		vs := make([]float64, len(s.samples))
+		for j, sm := range s.samples {
+			vs[j] = sm.v
+		}
+		if s.cfg.Method == "sma" {
+			sum := 0.0
+			for _, x := range vs {
+				sum += x
+			}
+			return sum / float64(len(vs))
+		}
+		p := s.cfg.Percentile
+		if p == 0 {
+			p = defaultPercentile
+		}
+		sort.Float64s(vs)
+		r := int(math.Ceil(p / 100 * float64(len(vs)))) // Nearest rank
+		if r < 1 {
+			r = 1
+		}
+		return vs[r-1]
+	}
+	return v
+}
+
+//---------------------------------------------------------------------------------
+// smoothValues()  --  Smooth the value of each of the Target's metrics. Returns 'vals' itself if
+// no metric is smoothed.
+func (t *Target) smoothValues(now time.Time, vals []float64) []float64 {
+	if t.smooth == nil {
+		return vals
+	}
+	out := make([]float64, len(vals))
+	for i, v := range vals {
+		out[i] = t.smooth[i].add(now, v)
+	}
+	return out
+}
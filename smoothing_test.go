@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSmoother(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  SmoothConfig
+		at   []int // Seconds from the start
+		vals []float64
+		want []float64
+	}{
+		{"none", SmoothConfig{},
+			[]int{0, 10}, []float64{5, 100}, []float64{5, 100}},
+		{"ewma halves every half_life", SmoothConfig{Method: "ewma", Half_Life: 10},
+			[]int{0, 10, 20, 40}, []float64{0, 100, 100, 100}, []float64{0, 50, 75, 93.75}},
+		{"sma over window", SmoothConfig{Method: "sma", Window: 30},
+			[]int{0, 10, 20, 30, 40}, []float64{10, 20, 30, 40, 50}, []float64{10, 15, 20, 30, 40}},
+		{"sma keeps the latest sample", SmoothConfig{Method: "sma", Window: 5},
+			[]int{0, 60}, []float64{10, 20}, []float64{10, 20}},
+		{"p95 by nearest rank", SmoothConfig{Method: "percentile", Window: 100},
+			[]int{0, 10, 20, 30}, []float64{40, 10, 30, 20}, []float64{40, 40, 40, 40}},
+		{"p50", SmoothConfig{Method: "percentile", Window: 100, Percentile: 50},
+			[]int{0, 10, 20, 30}, []float64{40, 10, 30, 20}, []float64{40, 10, 30, 20}},
+		{"percentile drops old samples", SmoothConfig{Method: "percentile", Window: 15},
+			[]int{0, 10, 20}, []float64{90, 10, 20}, []float64{90, 90, 20}},
+	}
+	t0 := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		s := &smoother{cfg: tt.cfg}
+		for i, v := range tt.vals {
+			got := s.add(t0.Add(time.Duration(tt.at[i])*time.Second), v)
+			if math.Abs(got-tt.want[i]) > 1e-9 {
+				t.Errorf("%s: sample %d = %g, want %g", tt.name, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCheckSmoothing(t *testing.T) {
+	for _, tt := range []struct {
+		sc SmoothConfig
+		ok bool
+	}{
+		{SmoothConfig{}, true},
+		{SmoothConfig{Method: "ewma", Half_Life: 30}, true},
+		{SmoothConfig{Method: "ewma"}, false},
+		{SmoothConfig{Method: "sma", Window: 60}, true},
+		{SmoothConfig{Method: "sma"}, false},
+		{SmoothConfig{Method: "percentile", Window: 60, Percentile: 99}, true},
+		{SmoothConfig{Method: "percentile", Window: 60, Percentile: 101}, false},
+		{SmoothConfig{Method: "median", Window: 60}, false},
+	} {
+		if err := checkSmoothing(tt.sc); (err == nil) != tt.ok {
+			t.Errorf("checkSmoothing(%+v) = %v", tt.sc, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+//
+//  target.go
+//   A Scale Target maps a Thunder SLB Virtual Server Port to the Kubernetes Deployment that serves it.
+//   One agent can watch any number of Targets, all sharing the same Thunder session and K8s Cluster.
+//
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"a10/axapi"
+)
+
+// TargetConfig is one entry of the 'targets' list in the config file.
+type TargetConfig struct {
+	Name        string           `yaml:"name"`
+	SLB         string           `yaml:"slb"`
+	SLB_Port    string           `yaml:"slb_port"`
+	Deployment  string           `yaml:"deployment"`
+	Namespace   string           `yaml:"namespace"`
+	Min_Pods    int              `yaml:"min_pods"`
+	Max_Pods    int              `yaml:"max_pods"`
+	Rate        uint64           `yaml:"rate"`
+	Rate_Source string           `yaml:"rate_source"` // gauges (default) or counters
+	Metrics     []MetricConfig   `yaml:"metrics"`
+	Policy      PolicyConfig     `yaml:"policy"`
+	Behavior    BehaviorConfig   `yaml:"behavior"`
+	Drain       DrainConfig      `yaml:"drain"`
+	Predictive  PredictConfig    `yaml:"predictive"`
+	Schedules   []ScheduleConfig `yaml:"schedules"`
+	Degraded    DegradedConfig   `yaml:"degraded"` // What to do without stats
+	Dry_Run     bool             `yaml:"dry_run"`  // Decide, but do not change the Deployment
+}
+
+// Target is a TargetConfig along with the state kept for it between passes of procLoop().
+type Target struct {
+	Cfg     TargetConfig
+	policy  ScalingPolicy
+	st      *stabilizer
+	pred    *predictor  // nil unless predictive scaling is on
+	smooth  []*smoother // One per metric; nil unless a metric is smoothed
+	scheds  []*schedule
+	active  string // Names of the schedules in effect on the last pass
+	clamped string // Limit ("min" or "max") the last decision was held to, if any
+	// Dry Run: the Replicas we would have set the Deployment to
+	simReplicas int
+	draining    int32         // drainIdle unless drainAndScale() is running (see drain.go); use atomic
+	stopDrain   chan struct{} // Closed to cancel the running drain
+	drainDone   chan struct{} // Closed once the running drain has finished
+	preDrain    time.Time     // When the Target was scaled before the running drain
+	// What the last pass saw & decided, for the A10Autoscaler status
+	current   int
+	simulated int // Dry Run: the Replicas the policy worked from
+	desired   int
+	lastErr   string
+	lastGood  time.Time // Of the last good Thunder stats, or when the Target was first checked
+	// Rates from counters: the previous Port stats
+	prevStats axapi.PortStats
+	prevAt    time.Time
+}
+
+//---------------------------------------------------------------------------------
+// targetConfigs()  --  Return the Scale Targets defined in the config file. If there is no 'targets'
+// list (and A10Autoscaler resources are not turned on), the single Deployment & SLB in the 'cluster'
+// and 'thunder' sections is used. Targets that do not set their own 'policy', 'behavior', 'drain',
+// 'predictive', 'schedules' or 'degraded' get the top level ones, and Targets without a 'metrics' list
+// are scaled on throughput using 'rate'.
+func (cfg Configuration) targetConfigs() []TargetConfig {
+	tcs := cfg.Targets
+	if len(tcs) == 0 && !cfg.CRD.Enabled {
+		tcs = []TargetConfig{{
+			SLB:         cfg.Thunder.SLB,
+			SLB_Port:    cfg.Thunder.SLB_Port,
+			Deployment:  cfg.Cluster.Deployment,
+			Namespace:   cfg.Cluster.Namespace,
+			Min_Pods:    cfg.Cluster.Min_Pods,
+			Max_Pods:    cfg.Cluster.Max_Pods,
+			Rate:        cfg.Thunder.Rate,
+			Rate_Source: cfg.Thunder.Rate_Source,
+		}}
+	}
+
+	out := make([]TargetConfig, 0, len(tcs))
+	for _, tc := range tcs {
+		out = append(out, cfg.withDefaults(tc))
+	}
+	return out
+}
+
+// withDefaults()  --  Fill in the settings a Target does not set itself from the top level config.
+func (cfg Configuration) withDefaults(tc TargetConfig) TargetConfig {
+	if tc.Name == "" {
+		tc.Name = tc.Namespace + "/" + tc.Deployment
+	}
+	if len(tc.Metrics) == 0 {
+		tc.Metrics = []MetricConfig{{Type: "throughput", Target: float64(tc.Rate)}}
+	}
+	if tc.Policy.Type == "" && tc.Policy.Tolerance == 0 && len(tc.Policy.Steps) == 0 {
+		tc.Policy = cfg.Policy
+	}
+	if tc.Behavior == (BehaviorConfig{}) {
+		tc.Behavior = cfg.Behavior
+	}
+	if tc.Drain == (DrainConfig{}) {
+		tc.Drain = cfg.Drain
+	}
+	if tc.Predictive == (PredictConfig{}) {
+		tc.Predictive = cfg.Predictive
+	}
+	if len(tc.Schedules) == 0 {
+		tc.Schedules = cfg.Schedules
+	}
+	if tc.Degraded == (DegradedConfig{}) {
+		tc.Degraded = cfg.Degraded
+	}
+	if tc.Rate_Source == "" {
+		tc.Rate_Source = cfg.Thunder.Rate_Source
+	}
+	tc.Dry_Run = tc.Dry_Run || cfg.Dry_Run
+	return tc
+}
+
+//---------------------------------------------------------------------------------
+// newTargets()  --  Set up the Scaling Policy, predictor and state for every Scale Target.
+func newTargets(cfg Configuration) ([]*Target, error) {
+	var ts []*Target
+	for i, tc := range cfg.targetConfigs() {
+		t, err := newTarget(cfg, tc)
+		if err != nil {
+			return nil, errors.New("target " + strconv.Itoa(i) + " (" + tc.Name + "): " + err.Error())
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// newTarget()  --  Set up one Scale Target from its (defaulted) settings.
+func newTarget(cfg Configuration, tc TargetConfig) (*Target, error) {
+	p, err := newPolicy(tc.Policy)
+	if err != nil {
+		return nil, err
+	}
+	if tc.Drain.Enabled && tc.Drain.Service_Group == "" {
+		return nil, errors.New("drain needs a 'service_group'")
+	}
+	if err := checkRateSource(tc.Rate_Source); err != nil {
+		return nil, err
+	}
+	if err := checkDegraded(tc.Degraded); err != nil {
+		return nil, errors.New("degraded: " + err.Error())
+	}
+	for _, mc := range tc.Metrics {
+		if err := checkMetric(mc); err != nil {
+			return nil, err
+		}
+	}
+	pr, err := newPredictor(tc.Predictive, cfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	t := &Target{Cfg: tc, policy: p, st: newStabilizer(tc.Behavior), pred: pr}
+	// One smoother per metric if any of them is smoothed, so they line up with the metric values
+	smoothed := false
+	for _, mc := range tc.Metrics {
+		if mc.Smoothing.Method != "" {
+			smoothed = true
+		}
+	}
+	if smoothed {
+		for _, mc := range tc.Metrics {
+			t.smooth = append(t.smooth, &smoother{cfg: mc.Smoothing})
+		}
+	}
+	for _, sc := range tc.Schedules {
+		sch, err := newSchedule(sc)
+		if err != nil {
+			return nil, err
+		}
+		t.scheds = append(t.scheds, sch)
+	}
+	return t, nil
+}
+
+//---------------------------------------------------------------------------------
+// update()  --  Take the settings of 'n', a freshly built copy of this Target, while keeping the
+// history, cooldown and drain state of the running one.
+func (t *Target) update(n *Target) {
+	for i := range n.smooth {
+		// Keep the history of metrics that are smoothed the same way as before
+		if i < len(t.smooth) {
+			om, nm := t.Cfg.Metrics[i], n.Cfg.Metrics[i]
+			if om.Type == nm.Type && om.Smoothing == nm.Smoothing {
+				n.smooth[i] = t.smooth[i]
+			}
+		}
+	}
+	t.smooth = n.smooth
+	t.Cfg = n.Cfg
+	t.policy = n.policy
+	t.st.cfg = n.Cfg.Behavior
+	t.scheds = n.scheds
+	if t.pred != nil && n.pred != nil {
+		n.pred.hist = t.pred.hist
+	}
+	t.pred = n.pred
+	if !n.Cfg.Dry_Run {
+		t.simReplicas = 0
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+//
+//  validate.go
+//   Config file checking. Used at startup, on every reload, and by the 'validate' command.
+//   The YAML is decoded strictly (unknown or repeated keys are errors), then every setting is checked.
+//   Errors carry the line number of the setting in the file; a setting that is missing is reported
+//   on the line of the section it belongs in.
+//
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// configError is one problem found in the config file.
+type configError struct {
+	Line int
+	Path string
+	Msg  string
+}
+
+func (e configError) String() string {
+	s := ""
+	if e.Line > 0 {
+		s = "line " + strconv.Itoa(e.Line) + ": "
+	}
+	if e.Path != "" {
+		s = s + e.Path + ": "
+	}
+	return s + e.Msg
+}
+
+// configErrors joins up all the problems found into a single error.
+func configErrors(errs []configError) error {
+	var lines []string
+	for _, e := range errs {
+		lines = append(lines, e.String())
+	}
+	return errors.New("invalid config:\n  " + strings.Join(lines, "\n  "))
+}
+
+var slbPortRE = regexp.MustCompile(`^([0-9]+)\+([a-z0-9-]+)$`)
+
+// A setting in seconds is a plain whole number; yaml.v2 would read "10s" as 10000000000 of them.
+var secondsRE = regexp.MustCompile(`^-?[0-9]+$`)
+
+// Longest allowed for settings in seconds. Besides catching typos, these keep every setting well
+// clear of overflowing when it is multiplied by time.Second.
+const (
+	maxHour  = 3600
+	maxDay   = 24 * maxHour
+	maxWeek  = 7 * maxDay
+	maxMonth = 31 * maxDay
+)
+
+// yaml.v2's strict decoding errors, ie. "field bogus not found in type struct { IP string ... }"
+var yamlKeyRE = regexp.MustCompile(`^field (\S+) (not found|already set) in type `)
+
+// validator collects errors, looking up line numbers as it goes.
+type validator struct {
+	lines map[string]int
+	vals  map[string]string // Scalar values as written in the file
+	errs  []configError
+}
+
+func (v *validator) add(path string, msg string) {
+	// Use the line of the closest parent if the setting itself is not in the file
+	p := path
+	line, ok := v.lines[p]
+	for !ok && p != "" {
+		if i := strings.LastIndex(p, "."); i >= 0 {
+			p = p[:i]
+		} else {
+			p = ""
+		}
+		line, ok = v.lines[p]
+	}
+	v.errs = append(v.errs, configError{Line: line, Path: path, Msg: msg})
+}
+
+// seconds()  --  Check a setting in seconds is a whole number without a unit, from min to max.
+// Returns false if it is not.
+func (v *validator) seconds(path string, d time.Duration, min time.Duration, max time.Duration) bool {
+	if s, ok := v.vals[path]; ok && !secondsRE.MatchString(s) {
+		v.add(path, "must be a whole number of seconds, without a unit")
+		return false
+	}
+	if d < min || d > max {
+		v.add(path, "must be "+strconv.FormatInt(int64(min), 10)+"-"+strconv.FormatInt(int64(max), 10)+" seconds")
+		return false
+	}
+	return true
+}
+
+func join(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+//---------------------------------------------------------------------------------
+// yamlPaths()  --  Map the dotted path of every key & list entry in the file to its line number,
+// ie. "targets.1.policy.steps.0.lower", and of every scalar to its value as written.
+func yamlPaths(raw []byte) (map[string]int, map[string]string) {
+	lines := map[string]int{"": 1}
+	vals := make(map[string]string)
+	var doc yamlv3.Node
+	if yamlv3.Unmarshal(raw, &doc) != nil {
+		return lines, vals
+	}
+	var walk func(n *yamlv3.Node, path string)
+	walk = func(n *yamlv3.Node, path string) {
+		switch n.Kind {
+		case yamlv3.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+		case yamlv3.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				p := join(path, n.Content[i].Value)
+				lines[p] = n.Content[i].Line
+				walk(n.Content[i+1], p)
+			}
+		case yamlv3.SequenceNode:
+			for i, c := range n.Content {
+				p := join(path, strconv.Itoa(i))
+				lines[p] = c.Line
+				walk(c, p)
+			}
+		case yamlv3.ScalarNode:
+			vals[path] = n.Value
+		}
+	}
+	walk(&doc, "")
+	return lines, vals
+}
+
+//---------------------------------------------------------------------------------
+// validateConfig()  --  Decode the config file and check every setting.
+func validateConfig(raw []byte) (Configuration, []configError) {
+	return checkConfig(raw, false)
+}
+
+// validateThunderConfig()  --  validateConfig() for the record command, which only talks to the Thunder
+// and takes its credentials from the command line: the 'cluster' section and the Thunder's Secret are
+// not needed, so are not checked.
+func validateThunderConfig(raw []byte) (Configuration, []configError) {
+	return checkConfig(raw, true)
+}
+
+// checkConfig()  --  The work of validateConfig() and validateThunderConfig().
+func checkConfig(raw []byte, thunderOnly bool) (Configuration, []configError) {
+	var c Configuration
+	lines, vals := yamlPaths(raw)
+	if err := yaml.UnmarshalStrict(raw, &c); err != nil {
+		var errs []configError
+		if te, ok := err.(*yaml.TypeError); ok {
+			for _, e := range te.Errors {
+				errs = append(errs, parseYamlError(e, lines))
+			}
+		} else {
+			errs = append(errs, parseYamlError(err.Error(), lines))
+		}
+		return c, errs
+	}
+
+	v := &validator{lines: lines, vals: vals}
+	if c.Debug < 0 {
+		v.add("debug", "cannot be negative")
+	}
+	if c.Log_Format != "" && c.Log_Format != "text" && c.Log_Format != "json" {
+		v.add("log_format", "must be 'text' or 'json'")
+	}
+	v.seconds("check_interval", c.Interval, 1, maxHour)
+	v.seconds("cmd_timeout", c.Timeout, 1, maxHour)
+	if c.HTTP.Ready_Intervals < 0 {
+		v.add("http.ready_intervals", "cannot be negative")
+	}
+	leaseOK := v.seconds("leader_election.lease_duration", c.Leader.Lease_Duration, 0, maxHour)
+	retryOK := v.seconds("leader_election.retry_period", c.Leader.Retry_Period, 0, maxHour)
+	if leaseOK && retryOK && c.Leader.Lease_Duration > 0 && c.Leader.Retry_Period >= c.Leader.Lease_Duration {
+		v.add("leader_election.retry_period", "must be less than lease_duration")
+	}
+	if c.Audit.Max_Size < 0 || c.Audit.Max_Files < 0 {
+		v.add("audit", "max_size and max_files cannot be negative")
+	}
+	if c.Retry.Attempts < 0 {
+		v.add("retry.attempts", "cannot be negative")
+	}
+	v.seconds("retry.backoff", c.Retry.Backoff, 0, maxHour)
+	v.seconds("retry.max_backoff", c.Retry.Max_Backoff, 0, maxHour)
+	if c.Breaker.Failures < 0 {
+		v.add("circuit_breaker.failures", "cannot be negative")
+	}
+	v.seconds("circuit_breaker.open_for", c.Breaker.Open_For, 0, maxHour)
+	if !thunderOnly {
+		if c.Cluster.IP == "" {
+			v.add("cluster.ip", "is required")
+		}
+		if c.Cluster.Port < 1 || c.Cluster.Port > 65535 {
+			v.add("cluster.port", "must be 1-65535")
+		}
+		if c.Cluster.Auth_Token == "" {
+			v.add("cluster.auth_token", "is required")
+		}
+		if c.Thunder.Secret == "" {
+			v.add("thunder.secret", "is required")
+		}
+		if c.Thunder.Secret_NS == "" {
+			v.add("thunder.secret_namespace", "is required")
+		}
+	}
+	if c.Thunder.IP == "" {
+		v.add("thunder.ip", "is required")
+	}
+	if c.Thunder.Port < 1 || c.Thunder.Port > 65535 {
+		v.add("thunder.port", "must be 1-65535")
+	}
+	if err := checkRateSource(c.Thunder.Rate_Source); err != nil {
+		v.add("thunder.rate_source", err.Error())
+	}
+
+	// Top level settings that Targets fall back on
+	v.checkPolicy("policy", c.Policy)
+	v.checkBehavior("behavior", c.Behavior)
+	v.checkDrain("drain", c.Drain)
+	v.checkPredictive("predictive", c.Predictive, c)
+	v.checkDegraded("degraded", c.Degraded)
+	for i, sc := range c.Schedules {
+		v.checkSchedule(join("schedules", strconv.Itoa(i)), sc)
+	}
+
+	if len(c.Targets) == 0 && c.CRD.Enabled {
+		// Every Target comes from A10Autoscaler resources
+	} else if len(c.Targets) == 0 {
+		// Single Target from the 'cluster' & 'thunder' sections
+		tc := c.targetConfigs()[0]
+		paths := map[string]string{
+			"slb": "thunder.slb", "slb_port": "thunder.slb_port", "rate": "thunder.rate",
+			"deployment": "cluster.deployment", "namespace": "cluster.namespace",
+			"min_pods": "cluster.min_pods", "max_pods": "cluster.max_pods",
+		}
+		v.checkTarget(func(k string) string { return paths[k] }, tc, true)
+	} else {
+		names := make(map[string]int)
+		for i, tc := range c.Targets {
+			path := join("targets", strconv.Itoa(i))
+			v.checkTarget(func(k string) string { return join(path, k) }, tc, len(tc.Metrics) == 0)
+			if err := checkRateSource(tc.Rate_Source); err != nil {
+				v.add(join(path, "rate_source"), err.Error())
+			}
+			v.checkPolicy(join(path, "policy"), tc.Policy)
+			v.checkBehavior(join(path, "behavior"), tc.Behavior)
+			v.checkDrain(join(path, "drain"), tc.Drain)
+			v.checkPredictive(join(path, "predictive"), tc.Predictive, c)
+			v.checkDegraded(join(path, "degraded"), tc.Degraded)
+			for j, sc := range tc.Schedules {
+				v.checkSchedule(join(path, "schedules."+strconv.Itoa(j)), sc)
+			}
+		}
+		for i, tc := range c.targetConfigs() {
+			if j, ok := names[tc.Name]; ok {
+				v.add(join("targets", strconv.Itoa(i)), "has the same name '"+tc.Name+"' as target "+strconv.Itoa(j))
+			}
+			names[tc.Name] = i
+		}
+	}
+
+	sort.SliceStable(v.errs, func(i, j int) bool { return v.errs[i].Line < v.errs[j].Line })
+	return c, v.errs
+}
+
+// parseYamlError()  --  Pull the line number out of a yaml error message. Unknown & repeated keys are
+// given the dotted path of the key from 'lines', in place of the Go type they did not fit.
+func parseYamlError(s string, lines map[string]int) configError {
+	s = strings.TrimPrefix(s, "yaml: ")
+	if strings.HasPrefix(s, "line ") {
+		if i := strings.Index(s, ":"); i > 0 {
+			if n, err := strconv.Atoi(s[5:i]); err == nil {
+				e := configError{Line: n, Msg: strings.TrimSpace(s[i+1:])}
+				if m := yamlKeyRE.FindStringSubmatch(e.Msg); m != nil {
+					e.Path, e.Msg = keyPath(lines, n, m[1]), "unknown key"
+					if m[2] == "already set" {
+						e.Msg = "repeated key"
+					}
+				}
+				return e
+			}
+		}
+	}
+	return configError{Msg: s}
+}
+
+// keyPath()  --  Find the dotted path of 'key' on line 'n' of the file. Falls back on the key itself.
+func keyPath(lines map[string]int, n int, key string) string {
+	for p, l := range lines {
+		if l == n && (p == key || strings.HasSuffix(p, "."+key)) {
+			return p
+		}
+	}
+	return key
+}
+
+//---------------------------------------------------------------------------------
+// checkTarget()  --  Check one Scale Target. 'at' gives the path of a Target setting.
+func (v *validator) checkTarget(at func(string) string, tc TargetConfig, useRate bool) {
+	if tc.SLB == "" {
+		v.add(at("slb"), "is required")
+	}
+	if m := slbPortRE.FindStringSubmatch(tc.SLB_Port); m == nil {
+		v.add(at("slb_port"), "'"+tc.SLB_Port+"' is not in <port>+<protocol> format, ie. \"80+http\"")
+	} else if n, _ := strconv.Atoi(m[1]); n < 1 || n > 65535 {
+		v.add(at("slb_port"), "port must be 1-65535")
+	}
+	if tc.Deployment == "" {
+		v.add(at("deployment"), "is required")
+	}
+	if tc.Namespace == "" {
+		v.add(at("namespace"), "is required")
+	}
+	if tc.Min_Pods < 0 {
+		v.add(at("min_pods"), "cannot be negative")
+	}
+	if tc.Max_Pods < 1 {
+		v.add(at("max_pods"), "must be at least 1")
+	} else if tc.Min_Pods > tc.Max_Pods {
+		v.add(at("min_pods"), "min_pods "+strconv.Itoa(tc.Min_Pods)+" is greater than max_pods "+strconv.Itoa(tc.Max_Pods))
+	}
+	if useRate {
+		if tc.Rate == 0 {
+			v.add(at("rate"), "must be greater than zero")
+		}
+		return
+	}
+	for i, mc := range tc.Metrics {
+		path := "metrics." + strconv.Itoa(i)
+		halfOK := v.seconds(at(path+".smoothing.half_life"), mc.Smoothing.Half_Life, 0, maxDay)
+		windowOK := v.seconds(at(path+".smoothing.window"), mc.Smoothing.Window, 0, maxDay)
+		if !halfOK || !windowOK {
+			continue
+		}
+		if err := checkMetric(mc); err != nil {
+			v.add(at(path), err.Error())
+		}
+	}
+}
+
+func (v *validator) checkPolicy(path string, pc PolicyConfig) {
+	if _, err := newPolicy(pc); err != nil {
+		v.add(path, err.Error())
+	}
+	for i, s := range pc.Steps {
+		if s.Lower < 0 || s.Upper < 0 {
+			v.add(join(path, "steps."+strconv.Itoa(i)), "bounds cannot be negative")
+		} else if s.Upper != 0 && s.Upper <= s.Lower {
+			v.add(join(path, "steps."+strconv.Itoa(i)+".upper"), "must be greater than lower")
+		}
+	}
+}
+
+func (v *validator) checkBehavior(path string, bc BehaviorConfig) {
+	v.seconds(join(path, "scale_up_window"), bc.ScaleUpWindow, 0, maxDay)
+	v.seconds(join(path, "scale_down_window"), bc.ScaleDownWindow, 0, maxDay)
+	v.seconds(join(path, "cooldown"), bc.Cooldown, 0, maxDay)
+}
+
+func (v *validator) checkDrain(path string, dc DrainConfig) {
+	if dc.Enabled && dc.Service_Group == "" {
+		v.add(join(path, "service_group"), "is required when drain is enabled")
+	}
+	v.seconds(join(path, "timeout"), dc.Timeout, 0, maxDay)
+}
+
+func (v *validator) checkPredictive(path string, pc PredictConfig, c Configuration) {
+	horizonOK := v.seconds(join(path, "horizon"), pc.Horizon, 0, maxDay)
+	seasonOK := v.seconds(join(path, "season"), pc.Season, 0, maxWeek)
+	historyOK := v.seconds(join(path, "history"), pc.History, 0, 4*maxWeek)
+	if !horizonOK || !seasonOK || !historyOK {
+		return
+	}
+	if _, err := newPredictor(pc, c.Interval); err != nil {
+		v.add(path, err.Error())
+	}
+}
+
+func (v *validator) checkDegraded(path string, dc DegradedConfig) {
+	if !v.seconds(join(path, "after"), dc.After, 0, maxDay) {
+		return
+	}
+	if err := checkDegraded(dc); err != nil {
+		v.add(path, err.Error())
+	}
+}
+
+func (v *validator) checkSchedule(path string, sc ScheduleConfig) {
+	if !v.seconds(join(path, "duration"), sc.Duration, 1, maxMonth) {
+		return
+	}
+	if _, err := newSchedule(sc); err != nil {
+		v.add(path, err.Error())
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testConfig = `check_interval: 10
+cmd_timeout: 30
+cluster:
+  ip: 10.1.1.220
+  port: 8443
+  auth_token: abc
+thunder:
+  ip: 10.1.1.33
+  port: 443
+  secret: thunder-access-creds
+  secret_namespace: default
+targets:
+  - name: web
+    slb: ws-vip
+    slb_port: "80+http"
+    deployment: webserver
+    namespace: cyan
+    min_pods: 1
+    max_pods: 10
+    rate: 20
+`
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(string) string
+		want []string // configError strings, in order
+	}{
+		{"valid", func(s string) string { return s }, nil},
+		{"unknown top level key",
+			func(s string) string { return s + "bogus: 1\n" },
+			[]string{"line 21: bogus: unknown key"}},
+		{"unknown thunder key",
+			func(s string) string { return strings.Replace(s, "thunder:\n", "thunder:\n  bogus: 1\n", 1) },
+			[]string{"line 8: thunder.bogus: unknown key"}},
+		{"unknown cluster key",
+			func(s string) string {
+				return strings.Replace(s, "  auth_token: abc\n", "  auth_token: abc\n  token: x\n", 1)
+			},
+			[]string{"line 7: cluster.token: unknown key"}},
+		{"unknown target key",
+			func(s string) string {
+				return strings.Replace(s, "    rate: 20\n", "    rate: 20\n    policy:\n      kind: x\n", 1)
+			},
+			[]string{"line 22: targets.0.policy.kind: unknown key"}},
+		{"repeated key",
+			func(s string) string { return s + "cmd_timeout: 5\n" },
+			[]string{"line 21: cmd_timeout: repeated key"}},
+		{"bad type",
+			func(s string) string { return strings.Replace(s, "port: 443", "port: https", 1) },
+			[]string{"line 9: cannot unmarshal !!str `https` into int"}},
+		{"missing setting is reported on its section",
+			func(s string) string { return strings.Replace(s, "  secret: thunder-access-creds\n", "", 1) },
+			[]string{"line 7: thunder.secret: is required"}},
+		{"bad values",
+			func(s string) string {
+				s = strings.Replace(s, "cmd_timeout: 30", "cmd_timeout: 0", 1)
+				s = strings.Replace(s, "port: 8443", "port: 70000", 1)
+				return strings.Replace(s, "min_pods: 1", "min_pods: 11", 1)
+			},
+			[]string{
+				"line 2: cmd_timeout: must be 1-3600 seconds",
+				"line 5: cluster.port: must be 1-65535",
+				"line 18: targets.0.min_pods: min_pods 11 is greater than max_pods 10",
+			}},
+		{"bad slb_port",
+			func(s string) string { return strings.Replace(s, `"80+http"`, `"http"`, 1) },
+			[]string{`line 15: targets.0.slb_port: 'http' is not in <port>+<protocol> format, ie. "80+http"`}},
+		{"duplicate target name",
+			func(s string) string {
+				i := strings.Index(s, "  - name: web")
+				return s + s[i:]
+			},
+			[]string{"line 21: targets.1: has the same name 'web' as target 0"}},
+		// yaml.v2 reads a duration with a unit as nanoseconds, ie. 10s as 10000000000
+		{"seconds without a unit",
+			func(s string) string {
+				return strings.Replace(s, "    rate: 20\n", "    rate: 20\n    behavior:\n      cooldown: 300\n", 1)
+			},
+			nil},
+		{"seconds with a unit",
+			func(s string) string { return strings.Replace(s, "check_interval: 10", "check_interval: 10s", 1) },
+			[]string{"line 1: check_interval: must be a whole number of seconds, without a unit"}},
+		{"nested seconds with a unit",
+			func(s string) string {
+				return strings.Replace(s, "    rate: 20\n", "    rate: 20\n    behavior:\n      cooldown: 5m\n", 1)
+			},
+			[]string{"line 22: targets.0.behavior.cooldown: must be a whole number of seconds, without a unit"}},
+		{"seconds with a unit in a list",
+			func(s string) string {
+				return s + "schedules:\n  - cron: \"0 9 * * *\"\n    duration: 1h\n    min_pods: 2\n"
+			},
+			[]string{"line 23: schedules.0.duration: must be a whole number of seconds, without a unit"}},
+		{"seconds too big",
+			func(s string) string {
+				s = strings.Replace(s, "check_interval: 10", "check_interval: 10000000000", 1)
+				return s + "leader_election:\n  enabled: true\n  lease_duration: 86400\n  retry_period: 5\n" +
+					"drain:\n  timeout: 99999999\n" +
+					"predictive:\n  horizon: 300\n  season: 86400\n  history: 99999999\n"
+			},
+			[]string{
+				"line 1: check_interval: must be 1-3600 seconds",
+				"line 23: leader_election.lease_duration: must be 0-3600 seconds",
+				"line 26: drain.timeout: must be 0-86400 seconds",
+				"line 30: predictive.history: must be 0-2419200 seconds",
+			}},
+		{"seconds negative",
+			func(s string) string { return s + "circuit_breaker:\n  open_for: -5\n" },
+			[]string{"line 22: circuit_breaker.open_for: must be 0-3600 seconds"}},
+		{"seconds as a quoted string",
+			func(s string) string { return strings.Replace(s, "cmd_timeout: 30", `cmd_timeout: "30"`, 1) },
+			[]string{"line 2: cannot unmarshal !!str `30` into time.Duration"}},
+	}
+	for _, tt := range tests {
+		_, errs := validateConfig([]byte(tt.edit(testConfig)))
+		var got []string
+		for _, e := range errs {
+			got = append(got, e.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\n got: %q\nwant: %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateThunderConfig(t *testing.T) {
+	// What the record command needs: no 'cluster' section, and no Thunder Secret
+	s := strings.Replace(testConfig, "cluster:\n  ip: 10.1.1.220\n  port: 8443\n  auth_token: abc\n", "", 1)
+	s = strings.Replace(s, "  secret: thunder-access-creds\n  secret_namespace: default\n", "", 1)
+	if _, errs := validateConfig([]byte(s)); len(errs) == 0 {
+		t.Error("validateConfig() passed a config with no 'cluster' section")
+	}
+	tests := []struct {
+		name string
+		edit func(string) string
+		want []string
+	}{
+		{"valid", func(s string) string { return s }, nil},
+		{"thunder ip still required",
+			func(s string) string { return strings.Replace(s, "  ip: 10.1.1.33\n", "", 1) },
+			[]string{"line 3: thunder.ip: is required"}},
+		{"targets still checked",
+			func(s string) string { return strings.Replace(s, `"80+http"`, `"http"`, 1) },
+			[]string{`line 9: targets.0.slb_port: 'http' is not in <port>+<protocol> format, ie. "80+http"`}},
+		{"other settings still checked",
+			func(s string) string { return strings.Replace(s, "check_interval: 10", "check_interval: 10s", 1) },
+			[]string{"line 1: check_interval: must be a whole number of seconds, without a unit"}},
+	}
+	for _, tt := range tests {
+		_, errs := validateThunderConfig([]byte(tt.edit(s)))
+		var got []string
+		for _, e := range errs {
+			got = append(got, e.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\n got: %q\nwant: %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestYamlPaths(t *testing.T) {
+	lines, vals := yamlPaths([]byte(testConfig))
+	for path, want := range map[string]int{
+		"":                1,
+		"cmd_timeout":     2,
+		"cluster":         3,
+		"thunder.ip":      8,
+		"targets.0":       13,
+		"targets.0.name":  13,
+		"targets.0.rate":  20,
+		"targets.0.slb":   14,
+		"thunder.missing": 0,
+	} {
+		if got := lines[path]; got != want {
+			t.Errorf("yamlPaths()[%q] = %d, want %d", path, got, want)
+		}
+	}
+	for path, want := range map[string]string{
+		"check_interval":     "10",
+		"thunder.ip":         "10.1.1.33",
+		"targets.0.slb_port": "80+http",
+	} {
+		if got := vals[path]; got != want {
+			t.Errorf("yamlPaths() value of %q = %q, want %q", path, got, want)
+		}
+	}
+	if _, ok := vals["targets.0"]; ok {
+		t.Error("yamlPaths() has a value for a mapping")
+	}
+}